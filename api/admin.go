@@ -0,0 +1,68 @@
+package api
+
+import (
+	bloomfilter "binge/bloom_filter"
+	"crypto/subtle"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+type RebuildResponseBody struct {
+	UserId   int64 `json:"user_id"`
+	Replayed int   `json:"replayed"`
+}
+
+// adminOnly guards operator endpoints with the shared X-Admin-Token header.
+// Without a configured token the admin routes are disabled entirely.
+func (a *API) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Admin-Token")
+		if a.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.adminToken)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *API) rebuildBloomFilter(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	replayed, err := bloomfilter.Rebuild(r.Context(), a.db, a.bf, userId)
+	if err != nil {
+		log.Printf("error rebuilding bloom filter for user %d: %v", userId, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, RebuildResponseBody{UserId: userId, Replayed: replayed})
+}
+
+// issueUserToken lets an operator hand a token to a user who cannot log in,
+// such as one who signed up before passwords existed and has yet to set one.
+func (a *API) issueUserToken(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := a.db.GetUser(r.Context(), userId); err == sql.ErrNoRows {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("error reading user %d: %v", userId, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	a.respondWithToken(w, userId)
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"binge/db/migr"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const sessionTTL = 30 * 24 * time.Hour
+
+// bcrypt ignores input past 72 bytes, so longer passwords are refused
+// rather than silently truncated.
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+type contextKey string
+
+const userIdKey contextKey = "user_id"
+
+func withUserId(ctx context.Context, userId int64) context.Context {
+	return context.WithValue(ctx, userIdKey, userId)
+}
+
+func userIdFromContext(ctx context.Context) (int64, bool) {
+	userId, ok := ctx.Value(userIdKey).(int64)
+	return userId, ok
+}
+
+// sessionKey stores sessions under a hash of the token, so a Redis dump does
+// not hand out working credentials.
+func sessionKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "session:" + hex.EncodeToString(sum[:])
+}
+
+// issueToken creates an opaque bearer token for userId and stores it in Redis.
+func (a *API) issueToken(userId int64) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("error generating token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	err := a.cache.R.Set(sessionKey(token), userId, sessionTTL).Err()
+	if err != nil {
+		return "", fmt.Errorf("error storing session: %w", err)
+	}
+	return token, nil
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return "", fmt.Errorf("password must be %d to %d bytes long", minPasswordLength, maxPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
+
+// authenticate resolves the bearer token to a user ID and puts it in the
+// request context. Handlers behind it must act as that user only.
+func (a *API) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		userId, err := a.cache.R.Get(sessionKey(token)).Int64()
+		if err == redis.Nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			log.Printf("error reading session: %v", err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withUserId(r.Context(), userId)))
+	})
+}
+
+func (a *API) revokeToken(w http.ResponseWriter, r *http.Request) {
+	token, _ := bearerToken(r)
+	if err := a.cache.R.Del(sessionKey(token)).Err(); err != nil {
+		log.Printf("error deleting session: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type LoginRequestBody struct {
+	UserId   int64  `json:"user_id"`
+	Password string `json:"password"`
+}
+
+// login issues a new token for a user who lost theirs or whose token
+// expired. Unknown users, users without a password and wrong passwords all
+// get the same 401.
+func (a *API) login(w http.ResponseWriter, r *http.Request) {
+	var requestBody LoginRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hash, err := a.db.GetPasswordHash(r.Context(), requestBody.UserId)
+	if err == sql.ErrNoRows {
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("error reading credentials of user %d: %v", requestBody.UserId, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(requestBody.Password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("error checking password of user %d: %v", requestBody.UserId, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	a.respondWithToken(w, requestBody.UserId)
+}
+
+// refreshToken swaps the caller's token for a new one with a fresh TTL, so
+// an active client never hits the expiry.
+func (a *API) refreshToken(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := a.issueToken(userId)
+	if err != nil {
+		log.Printf("error issuing token for user %d: %v", userId, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	old, _ := bearerToken(r)
+	if err := a.cache.R.Del(sessionKey(old)).Err(); err != nil {
+		log.Printf("error deleting refreshed session of user %d: %v", userId, err)
+	}
+
+	writeJSON(w, http.StatusOK, UResponseBody{UserId: userId, Token: token})
+}
+
+type PasswordRequestBody struct {
+	Password string `json:"password"`
+}
+
+// setPassword sets or changes the caller's password. Users who signed up
+// before passwords existed use it, with a token from the admin endpoint, to
+// be able to log in.
+func (a *API) setPassword(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var requestBody PasswordRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hash, err := hashPassword(requestBody.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = a.db.SetPasswordHash(r.Context(), migr.SetPasswordHashParams{UserID: userId, PasswordHash: hash})
+	if err != nil {
+		log.Printf("error storing password of user %d: %v", userId, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) respondWithToken(w http.ResponseWriter, userId int64) {
+	token, err := a.issueToken(userId)
+	if err != nil {
+		log.Printf("error issuing token for user %d: %v", userId, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, UResponseBody{UserId: userId, Token: token})
+}
@@ -0,0 +1,531 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"binge/db/migr"
+	"binge/es"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	defaultFeedDistance = "50km"
+	defaultFeedMinAge   = minUserAge
+	defaultFeedMaxAge   = 99
+	defaultFeedLimit    = 10
+	maxFeedLimit        = 50
+	// feedRefillSize is how many candidates are pulled from Elasticsearch
+	// whenever the ranked list runs low.
+	feedRefillSize = 100
+	feedTTL        = time.Hour
+)
+
+type FeedParams struct {
+	UserId          int64       `json:"user_id"`
+	Location        es.GeoPoint `json:"location"`
+	DesiredDistance es.Distance `json:"distance"`
+	MinAge          int         `json:"min_age"`
+	MaxAge          int         `json:"max_age"`
+	// Gender and InterestedIn are the requester's own profile values; the
+	// feed only shows candidates compatible with them in both directions.
+	Gender       string   `json:"gender,omitempty"`
+	InterestedIn []string `json:"interested_in,omitempty"`
+}
+
+type FResponseBody struct {
+	Users      []es.User `json:"users"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// feedState is the per-user feed session kept in Redis next to the ranked
+// candidate list. Session changes whenever the feed is restarted, which
+// invalidates cursors handed out for the previous list. CursorKey signs the
+// session's cursors. StartedAt anchors the recency ranking so that every
+// refill of the session scores candidates alike.
+type feedState struct {
+	Session     string        `json:"session"`
+	CursorKey   string        `json:"cursor_key"`
+	StartedAt   time.Time     `json:"started_at"`
+	Params      FeedParams    `json:"params"`
+	SearchAfter []interface{} `json:"search_after,omitempty"`
+	Exhausted   bool          `json:"exhausted"`
+}
+
+var (
+	errCursorSignature     = errors.New("invalid cursor signature")
+	errFeedOffsetTooFar    = errors.New("cursor offset is past the feed")
+	errFeedSessionReplaced = errors.New("feed session was replaced")
+)
+
+// feedCursor is handed to clients as base64 JSON followed by an HMAC of it
+// under the session's CursorKey; they must treat it as opaque.
+type feedCursor struct {
+	Session string `json:"s"`
+	Offset  int64  `json:"o"`
+}
+
+func cursorMAC(payload string, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func encodeCursor(c feedCursor, key string) string {
+	raw, _ := json.Marshal(c)
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return payload + "." + cursorMAC(payload, key)
+}
+
+// decodeCursor parses a cursor and checks its signature against key. A
+// cursor with a bad signature is still returned alongside
+// errCursorSignature, so callers can tell a cursor from an older session
+// from a forged one.
+func decodeCursor(s string, key string) (feedCursor, error) {
+	var c feedCursor
+	payload, sig, ok := strings.Cut(s, ".")
+	if !ok {
+		return c, fmt.Errorf("malformed cursor")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return c, err
+	}
+	if key == "" || !hmac.Equal([]byte(sig), []byte(cursorMAC(payload, key))) {
+		return c, errCursorSignature
+	}
+	if c.Offset < 0 {
+		return c, fmt.Errorf("negative offset")
+	}
+	return c, nil
+}
+
+func candidatesKey(userId int64) string {
+	return fmt.Sprintf("feed:%d:candidates", userId)
+}
+
+func feedStateKey(userId int64) string {
+	return fmt.Sprintf("feed:%d:state", userId)
+}
+
+func randomHex(n int) (string, error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// errInvalidFeedParams marks feedParams failures caused by the request
+// rather than by a backing store.
+type errInvalidFeedParams struct {
+	err error
+}
+
+func (e errInvalidFeedParams) Error() string {
+	return e.err.Error()
+}
+
+func ageParam(raw string, fallback int) (int, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	age, err := strconv.Atoi(raw)
+	if err != nil || age < minUserAge || age > maxUserAge {
+		return 0, fmt.Errorf("invalid age %q", raw)
+	}
+	return age, nil
+}
+
+// feedParams reads lat, lon, distance, min_age and max_age from the query
+// string. When the location is omitted the requester's stored location is
+// used; gender preferences always come from the stored profile.
+func (a *API) feedParams(r *http.Request, userId int64) (FeedParams, error) {
+	query := r.URL.Query()
+	params := FeedParams{UserId: userId}
+
+	user, err := a.db.GetUser(a.ctx, userId)
+	if err != nil {
+		return params, err
+	}
+	if user.Gender.Valid {
+		params.Gender = string(user.Gender.UsersGender)
+	}
+	if user.InterestedIn != "" {
+		params.InterestedIn = strings.Split(user.InterestedIn, ",")
+	}
+
+	if params.MinAge, err = ageParam(query.Get("min_age"), defaultFeedMinAge); err != nil {
+		return params, errInvalidFeedParams{err}
+	}
+	if params.MaxAge, err = ageParam(query.Get("max_age"), defaultFeedMaxAge); err != nil {
+		return params, errInvalidFeedParams{err}
+	}
+	if params.MaxAge < params.MinAge {
+		return params, errInvalidFeedParams{fmt.Errorf("max_age must not be below min_age")}
+	}
+
+	distance := query.Get("distance")
+	if distance == "" {
+		distance = defaultFeedDistance
+	}
+	d, err := es.ParseDistance(distance)
+	if err != nil {
+		return params, errInvalidFeedParams{err}
+	}
+	params.DesiredDistance = d
+
+	lat, lon := query.Get("lat"), query.Get("lon")
+	if lat == "" && lon == "" {
+		lat, lon = user.Latitude, user.Longitude
+	}
+	location, err := es.ParseGeoPoint(lat, lon)
+	if err != nil {
+		return params, errInvalidFeedParams{err}
+	}
+	params.Location = location
+
+	return params, nil
+}
+
+func feedLimit(r *http.Request) (int64, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return defaultFeedLimit, nil
+	}
+	limit, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || limit < 1 || limit > maxFeedLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxFeedLimit)
+	}
+	return limit, nil
+}
+
+// fetchFeed serves GET /users/feed?cursor=...&limit=N. Without a cursor a new
+// feed session is started from the given (or stored) location; with one, the
+// next page of the existing session's ranked candidate list is returned.
+func (a *API) fetchFeed(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit, err := feedLimit(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var state feedState
+	var offset int64
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		state, err = a.loadFeedState(userId)
+		if err == redis.Nil {
+			http.Error(w, "feed expired, request it again without a cursor", http.StatusGone)
+			return
+		}
+		if err != nil {
+			log.Printf("error loading feed state for user %d: %v", userId, err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		cursor, err := decodeCursor(raw, state.CursorKey)
+		if err == errCursorSignature && cursor.Session != state.Session {
+			http.Error(w, "feed expired, request it again without a cursor", http.StatusGone)
+			return
+		}
+		if err != nil {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		offset = cursor.Offset
+	} else {
+		params, err := a.feedParams(r, userId)
+		if invalid, ok := err.(errInvalidFeedParams); ok {
+			http.Error(w, invalid.Error(), http.StatusBadRequest)
+			return
+		}
+		if err == sql.ErrNoRows {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("error loading feed location: %v", err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		state, err = a.startFeed(params)
+		if err != nil {
+			log.Printf("error starting feed for user %d: %v", userId, err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	users, total, state, err := a.feedPage(state, offset, limit)
+	if err == errFeedOffsetTooFar {
+		http.Error(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
+	if err == errFeedSessionReplaced {
+		http.Error(w, "feed expired, request it again without a cursor", http.StatusGone)
+		return
+	}
+	if err != nil {
+		log.Printf("error building feed for user %d: %v", userId, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := FResponseBody{Users: users}
+	next := offset + int64(len(users))
+	if next < total || !state.Exhausted {
+		response.NextCursor = encodeCursor(feedCursor{Session: state.Session, Offset: next}, state.CursorKey)
+	}
+	if err := writeJSON(w, http.StatusOK, response); err == nil {
+		a.markSeen(userId, users)
+	}
+}
+
+// startFeed discards any previous candidate list and opens a new session.
+func (a *API) startFeed(params FeedParams) (feedState, error) {
+	session, err := randomHex(8)
+	if err != nil {
+		return feedState{}, err
+	}
+	cursorKey, err := randomHex(32)
+	if err != nil {
+		return feedState{}, err
+	}
+	state := feedState{
+		Session:   session,
+		CursorKey: cursorKey,
+		StartedAt: time.Now().UTC().Truncate(time.Second),
+		Params:    params,
+	}
+
+	if err := a.cache.R.Del(candidatesKey(params.UserId)).Err(); err != nil {
+		return state, err
+	}
+	return state, a.saveFeedState(state)
+}
+
+func (a *API) loadFeedState(userId int64) (feedState, error) {
+	var state feedState
+	val, err := a.cache.R.Get(feedStateKey(userId)).Result()
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal([]byte(val), &state)
+	return state, err
+}
+
+func (a *API) saveFeedState(state feedState) error {
+	pipe := a.cache.R.TxPipeline()
+	if err := queueSaveFeedState(pipe, state); err != nil {
+		return err
+	}
+	_, err := pipe.Exec()
+	return err
+}
+
+// queueSaveFeedState queues the writes that store state and refresh the
+// session's TTL.
+func queueSaveFeedState(pipe redis.Pipeliner, state feedState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	userId := state.Params.UserId
+	pipe.Set(feedStateKey(userId), data, feedTTL)
+	pipe.Expire(candidatesKey(userId), feedTTL)
+	return nil
+}
+
+// feedPage returns limit candidates starting at offset, topping the list up
+// from Elasticsearch first so that at least one more page stays buffered.
+// It also returns the current length of the candidate list. Offsets more
+// than a page past the list cannot have come from a cursor we issued, and
+// are refused rather than refilled up to.
+func (a *API) feedPage(state feedState, offset int64, limit int64) ([]es.User, int64, feedState, error) {
+	key := candidatesKey(state.Params.UserId)
+	total, err := a.cache.R.LLen(key).Result()
+	if err != nil {
+		return nil, 0, state, err
+	}
+	if offset > total+limit {
+		return nil, 0, state, errFeedOffsetTooFar
+	}
+
+	for total < offset+2*limit && !state.Exhausted {
+		if state, err = a.refillFeed(state); err != nil {
+			return nil, 0, state, err
+		}
+		if total, err = a.cache.R.LLen(key).Result(); err != nil {
+			return nil, 0, state, err
+		}
+	}
+
+	raw, err := a.cache.R.LRange(key, offset, offset+limit-1).Result()
+	if err != nil {
+		return nil, 0, state, err
+	}
+	users := make([]es.User, 0, len(raw))
+	for _, item := range raw {
+		var user es.User
+		if err := json.Unmarshal([]byte(item), &user); err != nil {
+			return nil, 0, state, fmt.Errorf("error deserializing feed candidate: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	total, err = a.cache.R.LLen(key).Result()
+	return users, total, state, err
+}
+
+// refillFeed appends the next page of Elasticsearch hits, continuing after
+// the last hit seen, to the candidate list.
+//
+// Concurrent requests for the same session would otherwise both page from
+// the same search_after and push the same candidates twice, so the append
+// only happens if the stored state is still the one this refill started
+// from. The loser adopts the winner's state instead.
+func (a *API) refillFeed(state feedState) (feedState, error) {
+	started, err := json.Marshal(state)
+	if err != nil {
+		return state, err
+	}
+	params := state.Params
+	excludeIDs, err := a.excludedFromFeed(params.UserId)
+	if err != nil {
+		return state, fmt.Errorf("error listing users excluded from feed: %w", err)
+	}
+	hits, err := a.es.RetrieveUserFilteredData(a.es.Index, es.UserSearch{
+		Location:     params.Location,
+		Distance:     params.DesiredDistance,
+		ExcludeIDs:   excludeIDs,
+		Size:         feedRefillSize,
+		SearchAfter:  state.SearchAfter,
+		Genders:      params.InterestedIn,
+		InterestedIn: params.Gender,
+		MinAge:       params.MinAge,
+		MaxAge:       params.MaxAge,
+		Ranking:      &a.es.Ranking,
+		RankedAt:     state.StartedAt,
+	})
+	if err != nil {
+		return state, err
+	}
+	if len(hits) < feedRefillSize {
+		state.Exhausted = true
+	}
+	if len(hits) > 0 {
+		state.SearchAfter = hits[len(hits)-1].Sort
+	}
+
+	// Swipes and matches are excluded exactly by the query; the bloom
+	// filter additionally hides profiles that were already shown.
+	var candidates []interface{}
+	for _, hit := range hits {
+		isMember, err := a.bf.Test(params.UserId, hit.Source.ID)
+		if err != nil {
+			return state, fmt.Errorf("error with membership checks in bloom filter: %w", err)
+		}
+		if isMember {
+			continue
+		}
+		hit.Source.Score = hit.Score
+		data, err := json.Marshal(hit.Source)
+		if err != nil {
+			return state, err
+		}
+		candidates = append(candidates, data)
+	}
+
+	stateKey := feedStateKey(params.UserId)
+	err = a.cache.R.Watch(func(tx *redis.Tx) error {
+		current, err := tx.Get(stateKey).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if !feedStatesEqual(current, started) {
+			return redis.TxFailedErr
+		}
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			if len(candidates) > 0 {
+				pipe.RPush(candidatesKey(params.UserId), candidates...)
+			}
+			return queueSaveFeedState(pipe, state)
+		})
+		return err
+	}, stateKey)
+	if err != redis.TxFailedErr {
+		return state, err
+	}
+
+	latest, err := a.loadFeedState(params.UserId)
+	if err != nil {
+		return state, err
+	}
+	if latest.Session != state.Session {
+		return state, errFeedSessionReplaced
+	}
+	return latest, nil
+}
+
+// feedStatesEqual compares two serialized feed states by value, since key
+// order and number formatting may differ between encodings.
+func feedStatesEqual(a string, b []byte) bool {
+	var x, y feedState
+	if json.Unmarshal([]byte(a), &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	ra, _ := json.Marshal(x)
+	rb, _ := json.Marshal(y)
+	return string(ra) == string(rb)
+}
+
+// maxExcludedIDs stays under Elasticsearch's default index.max_terms_count.
+// Only the most recent swipes and matches are excluded exactly; anyone past
+// the cap is still caught by the bloom filter.
+const maxExcludedIDs = 65536
+
+// excludedFromFeed lists the requester and everyone they have swiped on or
+// matched with, none of whom may appear in their feed.
+func (a *API) excludedFromFeed(userId int64) ([]int64, error) {
+	ids, err := a.db.ListExcludedUserIDs(a.ctx, migr.ListExcludedUserIDsParams{
+		UserID: userId,
+		Limit:  maxExcludedIDs - 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(ids, userId), nil
+}
+
+// markSeen records profiles in the requester's Bloom filter once they have
+// actually been written to the client, so they are not shown again.
+func (a *API) markSeen(userId int64, users []es.User) {
+	for _, user := range users {
+		if err := a.bf.Add(userId, user.ID); err != nil {
+			log.Printf("error adding user %d to bloom filter for %d: %v", user.ID, userId, err)
+		}
+	}
+}
@@ -7,26 +7,91 @@ import (
 	"net/http"
 )
 
+// MRequestBody describes a match between the authenticated caller and UserId2.
 type MRequestBody struct {
-	UserId1 int64 `json:"user_id_1"`
 	UserId2 int64 `json:"user_id_2"`
 }
 
+type MResponseBody struct {
+	MatchId int64 `json:"match_id"`
+}
+
 func (a *API) createMatch(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	var requestBody MRequestBody
 	err := json.NewDecoder(r.Body).Decode(&requestBody)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	err = a.db.InsertMatch(a.ctx, migr.InsertMatchParams{
-		UserID1: requestBody.UserId1,
-		UserID2: requestBody.UserId2,
-	})
+	if requestBody.UserId2 == userId {
+		http.Error(w, "cannot match with yourself", http.StatusBadRequest)
+		return
+	}
+	mutual, err := a.mutualRightSwipes(userId, requestBody.UserId2)
+	if err != nil {
+		log.Printf("error checking swipes between %d and %d: %v", userId, requestBody.UserId2, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !mutual {
+		http.Error(w, "both users must have swiped right on each other", http.StatusForbidden)
+		return
+	}
+	matchId, err := a.createMatchHandler(userId, requestBody.UserId2)
 	if err != nil {
 		log.Printf("error creating match: %v", err)
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	writeJSON(w, http.StatusOK, MResponseBody{MatchId: matchId})
+}
+
+// mutualRightSwipes reports whether userA and userB swiped right on each
+// other, either through the atomic swipe endpoint, which keeps swipes in
+// Redis, or through batched swipes stored in MySQL.
+func (a *API) mutualRightSwipes(userA, userB int64) (bool, error) {
+	swipes, err := a.cache.R.HMGet(getKey(userA, userB), getSwipeField(userA), getSwipeField(userB)).Result()
+	if err != nil {
+		return false, err
+	}
+	if swipes[0] == "right" && swipes[1] == "right" {
+		return true, nil
+	}
+	return a.db.HasMutualRightSwipes(a.ctx, migr.HasMutualRightSwipesParams{
+		UserA: userA,
+		UserB: userB,
+	})
+}
+
+// createMatchHandler persists the match between userA and userB. The pair is
+// stored in ascending order so that (a, b) and (b, a) hit the same unique key,
+// which makes concurrent mutual swipes resolve to a single row.
+func (a *API) createMatchHandler(userA, userB int64) (int64, error) {
+	if userA > userB {
+		userA, userB = userB, userA
+	}
+	return a.db.InsertMatch(a.ctx, migr.InsertMatchParams{
+		UserID1: userA,
+		UserID2: userB,
+	})
+}
+
+// writeJSON writes v as the response body. A non-nil error means the client
+// did not receive it.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	response, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Error processing response", http.StatusInternalServerError)
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(response)
+	return err
 }
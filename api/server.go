@@ -12,37 +12,50 @@ import (
 )
 
 type API struct {
-	httpC *http.Client
-	db    *db.DB
-	ctx   context.Context
-	cache *cache.Cache
-	es    *es.ES
-	bfpu  *bloomfilter.BloomFilterPerUser
+	httpC      *http.Client
+	db         *db.DB
+	ctx        context.Context
+	cache      *cache.Cache
+	es         *es.ES
+	bf         bloomfilter.Store
+	adminToken string
 }
 
-func NewAPIServer(database *db.DB, cache *cache.Cache, es *es.ES, bf *bloomfilter.BloomFilterPerUser) *chi.Mux {
+func NewAPIServer(database *db.DB, cache *cache.Cache, es *es.ES, bf bloomfilter.Store, adminToken string) *chi.Mux {
 	api := &API{
-		httpC: &http.Client{},
-		db:    database,
-		ctx:   context.Background(),
-		cache: cache,
-		es:    es,
-		bfpu:  bf,
+		httpC:      &http.Client{},
+		db:         database,
+		ctx:        context.Background(),
+		cache:      cache,
+		es:         es,
+		bf:         bf,
+		adminToken: adminToken,
 	}
 
 	r := chi.NewRouter()
 
 	r.Route("/users", func(r chi.Router) {
 		r.Post("/", api.createUser)
-		r.Get("/feed", api.fetchFeed)
+		r.Post("/login", api.login)
+		r.With(api.authenticate).Get("/feed", api.fetchFeed)
+		r.With(api.authenticate).Post("/token", api.refreshToken)
+		r.With(api.authenticate).Delete("/token", api.revokeToken)
+		r.With(api.authenticate).Put("/password", api.setPassword)
 	})
 	r.Route("/matches", func(r chi.Router) {
+		r.Use(api.authenticate)
 		r.Post("/", api.createMatch)
 	})
 	r.Route("/swipes", func(r chi.Router) {
+		r.Use(api.authenticate)
 		r.Post("/", api.createSwipe)
 		r.Post("/atomic", api.atomicSwipe)
 	})
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(api.adminOnly)
+		r.Post("/users/{userID}/bloom/rebuild", api.rebuildBloomFilter)
+		r.Post("/users/{userID}/token", api.issueUserToken)
+	})
 
 	return r
 }
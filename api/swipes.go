@@ -6,47 +6,93 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+
+	"github.com/go-redis/redis"
 )
 
+// SRequestBody describes a swipe by the authenticated caller on UserId2.
 type SRequestBody struct {
-	UserId1        int64  `json:"user_id_1"`
 	UserId2        int64  `json:"user_id_2"`
 	SwipeDirection string `json:"swipe_direction"`
 }
 
+func validSwipeDirection(direction string) bool {
+	switch migr.SwipesSwipeType(direction) {
+	case migr.SwipesSwipeTypeLeft, migr.SwipesSwipeTypeRight:
+		return true
+	}
+	return false
+}
+
+type SResponseBody struct {
+	Matched bool  `json:"matched"`
+	MatchId int64 `json:"match_id,omitempty"`
+}
+
 func (a *API) atomicSwipe(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	var requestBody SRequestBody
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if requestBody.UserId2 == userId {
+		http.Error(w, "cannot swipe on yourself", http.StatusBadRequest)
+		return
+	}
+	if !validSwipeDirection(requestBody.SwipeDirection) {
+		http.Error(w, "swipe_direction must be left or right", http.StatusBadRequest)
+		return
+	}
+
+	// The swipes table is the record of swipes that feed exclusion, bloom
+	// filter rebuilds, scoring and analytics read; Redis only detects the
+	// mutual swipe.
+	err := a.db.InsertSwipe(a.ctx, migr.InsertSwipeParams{
+		UserSwiped:   userId,
+		UserSwipedOn: requestBody.UserId2,
+		SwipeType:    migr.SwipesSwipeType(requestBody.SwipeDirection),
+	})
+	if err != nil {
+		log.Printf("error inserting swipe: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
 
-	key := getKey(requestBody.UserId1, requestBody.UserId2)
+	key := getKey(userId, requestBody.UserId2)
 
 	luaScript := `
 	redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
 	return redis.call('HGET', KEYS[1], ARGV[3])
 	`
 
-	swipeField := getSwipeField(requestBody.UserId1)
+	swipeField := getSwipeField(userId)
 	otherField := getSwipeField(requestBody.UserId2)
 	result, err := a.cache.R.Eval(luaScript, []string{key}, swipeField, requestBody.SwipeDirection, otherField).Result()
-	if err != nil {
+	if err != nil && err != redis.Nil {
 		log.Printf("error executing redis lua script: %v", err)
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
+	a.markSwiped(userId, requestBody.UserId2)
 
+	var response SResponseBody
 	if requestBody.SwipeDirection == "right" && result == "right" {
-		err := a.createMatchHandler(requestBody.UserId1, requestBody.UserId2)
+		matchId, err := a.createMatchHandler(userId, requestBody.UserId2)
 		if err != nil {
 			log.Printf("error creating match: %v", err)
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
 		}
+		response = SResponseBody{Matched: true, MatchId: matchId}
 	}
 
-	w.WriteHeader(http.StatusOK)
+	writeJSON(w, http.StatusOK, response)
 }
 
 func getKey(userA, userB int64) string {
@@ -60,11 +106,13 @@ func getSwipeField(userA int64) string {
 	return fmt.Sprintf("%d_swipe", userA)
 }
 
-func (a *API) createMatchHandler(userA, userB int64) error {
-	return nil
-}
-
 func (a *API) createSwipe(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	var requestBody []SRequestBody
 	err := json.NewDecoder(r.Body).Decode(&requestBody)
 	if err != nil {
@@ -72,10 +120,16 @@ func (a *API) createSwipe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	for _, swipe := range requestBody {
+		if !validSwipeDirection(swipe.SwipeDirection) {
+			http.Error(w, "swipe_direction must be left or right", http.StatusBadRequest)
+			return
+		}
+	}
 	for _, swipe := range requestBody {
 		swipeType := migr.SwipesSwipeType(swipe.SwipeDirection)
 		err := a.db.InsertSwipe(a.ctx, migr.InsertSwipeParams{
-			UserSwiped:   swipe.UserId1,
+			UserSwiped:   userId,
 			UserSwipedOn: swipe.UserId2,
 			SwipeType:    swipeType,
 		})
@@ -84,7 +138,14 @@ func (a *API) createSwipe(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
 		}
+		a.markSwiped(userId, swipe.UserId2)
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+func (a *API) markSwiped(swiper, swipedOn int64) {
+	if err := a.bf.Add(swiper, swipedOn); err != nil {
+		log.Printf("error adding user %d to bloom filter for %d: %v", swipedOn, swiper, err)
+	}
+}
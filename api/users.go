@@ -1,151 +1,116 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
-	bloomfilter "binge/bloom_filter"
 	"binge/db/migr"
 	"binge/es"
+)
 
-	"github.com/go-redis/redis"
+// minUserAge and maxUserAge bound the ages users may have, and so the ages
+// a feed can ask for.
+const (
+	minUserAge = 18
+	maxUserAge = 120
 )
 
+type UResponseBody struct {
+	UserId int64  `json:"user_id"`
+	Token  string `json:"token"`
+}
+
 type URequestBody struct {
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Bio       string `json:"bio"`
-	Longitude string `json:"longitude"`
-	Latitude  string `json:"latitude"`
+	FirstName    string   `json:"first_name"`
+	LastName     string   `json:"last_name"`
+	Bio          string   `json:"bio"`
+	Longitude    string   `json:"longitude"`
+	Latitude     string   `json:"latitude"`
+	Birthdate    string   `json:"birthdate"`
+	Gender       string   `json:"gender"`
+	InterestedIn []string `json:"interested_in"`
+	Password     string   `json:"password"`
 }
 
-func (a *API) createUser(w http.ResponseWriter, r *http.Request) {
-	var requestBody URequestBody
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+func validGender(gender string) bool {
+	switch migr.UsersGender(gender) {
+	case migr.UsersGenderMan, migr.UsersGenderWoman, migr.UsersGenderNonbinary:
+		return true
 	}
-	err = a.db.InsertUser(a.ctx, migr.InsertUserParams{
-		FirstName: requestBody.FirstName,
-		LastName:  requestBody.LastName,
-		Bio:       requestBody.Bio,
-		Longitude: requestBody.Longitude,
-		Latitude:  requestBody.Latitude,
-	})
+	return false
+}
 
+// profileParams validates the profile fields of a signup and converts
+// them to their column types.
+func (u URequestBody) profileParams() (sql.NullTime, migr.NullUsersGender, string, error) {
+	birthdate, err := time.Parse("2006-01-02", u.Birthdate)
 	if err != nil {
-		log.Printf("error creating user: %v", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
-		return
+		return sql.NullTime{}, migr.NullUsersGender{}, "", fmt.Errorf("birthdate must be YYYY-MM-DD")
 	}
-
-	//init bloom filter for this user
-	bf, err := bloomfilter.NewBloomFilterForUser(1024, fmt.Sprintf("%s-%s", requestBody.FirstName, requestBody.LastName))
-	if err != nil {
-		log.Printf("error creating user: %v", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
-		return
+	now := time.Now()
+	if birthdate.AddDate(minUserAge, 0, 0).After(now) {
+		return sql.NullTime{}, migr.NullUsersGender{}, "", fmt.Errorf("users must be at least %d years old", minUserAge)
 	}
-	a.bfpu = bf
-
-	w.WriteHeader(http.StatusOK)
-}
-
-type FRequestBody struct {
-	FirstName       string `json:"first_name"`
-	LastName        string `json:"last_name"`
-	Longitude       string `json:"longitude"`
-	Latitude        string `json:"latitude"`
-	DesiredDistance string `json:"distance"`
+	if birthdate.AddDate(maxUserAge, 0, 0).Before(now) {
+		return sql.NullTime{}, migr.NullUsersGender{}, "", fmt.Errorf("birthdate %s is too far in the past", u.Birthdate)
+	}
+	// The location is stored as given, so it must be one the feed and the
+	// users index can use.
+	if _, err := es.ParseGeoPoint(u.Latitude, u.Longitude); err != nil {
+		return sql.NullTime{}, migr.NullUsersGender{}, "", err
+	}
+	if !validGender(u.Gender) {
+		return sql.NullTime{}, migr.NullUsersGender{}, "", fmt.Errorf("invalid gender %q", u.Gender)
+	}
+	for _, g := range u.InterestedIn {
+		if !validGender(g) {
+			return sql.NullTime{}, migr.NullUsersGender{}, "", fmt.Errorf("invalid interested_in %q", g)
+		}
+	}
+	return sql.NullTime{Time: birthdate, Valid: true},
+		migr.NullUsersGender{UsersGender: migr.UsersGender(u.Gender), Valid: true},
+		strings.Join(u.InterestedIn, ","),
+		nil
 }
 
-func (a *API) fetchFeed(w http.ResponseWriter, r *http.Request) {
-	var requestBody FRequestBody
+func (a *API) createUser(w http.ResponseWriter, r *http.Request) {
+	var requestBody URequestBody
 	err := json.NewDecoder(r.Body).Decode(&requestBody)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	feedKey := fmt.Sprintf("%s-%s:feed", requestBody.FirstName, requestBody.LastName)
-
-	val, err := a.cache.R.Get(feedKey).Result()
+	birthdate, gender, interestedIn, err := requestBody.profileParams()
 	if err != nil {
-		if err == redis.Nil {
-			hits, err := a.es.RetrieveUserFilteredData("users",
-				requestBody.Latitude,
-				requestBody.Longitude,
-				requestBody.DesiredDistance)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			var filteredResults []es.User
-			for _, hit := range hits {
-				isMember, err := a.bfpu.MembershipCheck(fmt.Sprintf("%s-%s", hit.Source.FirstName, hit.Source.LastName), fmt.Sprintf("%s-%s", requestBody.FirstName, requestBody.LastName))
-				if err != nil {
-					http.Error(w, "Error with membership checks in bloom filter", http.StatusInternalServerError)
-					return
-				}
-				if !isMember && (fmt.Sprintf("%s-%s", hit.Source.FirstName, hit.Source.LastName) != fmt.Sprintf("%s-%s", requestBody.FirstName, requestBody.LastName)) {
-					filteredResults = append(filteredResults, hit.Source)
-				}
-			}
-
-			// Split results: 60% for cache, 40% for immediate return
-			splitIndex := int(float64(len(filteredResults)) * 0.6)
-			cacheResults := filteredResults[:splitIndex]
-			immediateResults := filteredResults[splitIndex:]
-
-			// Cache 60% of the results
-			cacheData, err := json.Marshal(cacheResults)
-			if err != nil {
-				http.Error(w, "Error marshaling data for cache", http.StatusInternalServerError)
-				return
-			}
-
-			err = a.cache.R.Set(feedKey, cacheData, time.Hour).Err()
-			if err != nil {
-				log.Printf("error setting cache: %v", err)
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			response, err := json.Marshal(immediateResults)
-			if err != nil {
-				http.Error(w, "Error processing response", http.StatusInternalServerError)
-				return
-			}
-			w.Write(response)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Cache hit - parse and return cached data (60% of original results)
-	var retrievedData []map[string]interface{}
-	err = json.Unmarshal([]byte(val), &retrievedData)
+	passwordHash, err := hashPassword(requestBody.Password)
 	if err != nil {
-		log.Printf("Error deserializing cached data: %v", err)
-		http.Error(w, "Error processing cached data", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	userId, err := a.db.InsertUserWithPassword(a.ctx, migr.InsertUserParams{
+		FirstName:    requestBody.FirstName,
+		LastName:     requestBody.LastName,
+		Bio:          requestBody.Bio,
+		Longitude:    requestBody.Longitude,
+		Latitude:     requestBody.Latitude,
+		Birthdate:    birthdate,
+		Gender:       gender,
+		InterestedIn: interestedIn,
+	}, passwordHash)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	response, err := json.Marshal(retrievedData)
 	if err != nil {
-		http.Error(w, "Error processing response", http.StatusInternalServerError)
+		log.Printf("error creating user: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
-	_, err = a.cache.R.Del(feedKey).Result()
-	if err != nil {
-		log.Printf("error deleting cache: %v", err)
-	}
-	w.Write(response)
+
+	a.respondWithToken(w, userId)
 }
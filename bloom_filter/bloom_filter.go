@@ -1,124 +1,123 @@
 package bloomfilter
 
 import (
-	"fmt"
-
-	"github.com/segmentio/kafka-go"
-	"github.com/spaolacci/murmur3"
+	"log"
+	"sync"
 )
 
-type BloomFilter struct {
-	filter []byte
-	size   int
-}
+const shardCount = 32
 
-type userToFilterMap struct {
-	m map[string]*BloomFilter
+// filterShard owns a slice of the user ID space. Its lock guards both the
+// map and the bits of every filter stored in it.
+type filterShard struct {
+	mu sync.RWMutex
+	m  map[int64]*ScalableBloomFilter
 }
 
+// BloomFilterPerUser is an in-memory Store. Filters are lost on restart and
+// are not shared between replicas, so it is meant for tests and local runs.
 type BloomFilterPerUser struct {
-	bfMap                         *userToFilterMap
-	queueConnForFalsePositives    *kafka.Conn
-	queueConnForFilterSizeChanges *kafka.Conn
+	shards [shardCount]*filterShard
+	cfg    Config
 }
 
-var globalBloomFilter BloomFilterPerUser
-
-func InitializeGlobalBloomFilter() (*BloomFilterPerUser, error) {
-	bfMap := &userToFilterMap{
-		m: make(map[string]*BloomFilter),
-	}
-
-	bf := &BloomFilterPerUser{
-		bfMap:                         bfMap,
+func NewBloomFilterPerUser(cfg Config) (*BloomFilterPerUser, error) {
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
 	}
 
-	globalBloomFilter = *bf
-
-	return bf, nil
-}
-
-func NewBloomFilterForUser(size int, userID string) (*BloomFilterPerUser, error) {
-
-	if _, exists := globalBloomFilter.bfMap.m[userID]; exists {
-		return nil, nil
+	bfpu := &BloomFilterPerUser{
+		cfg: cfg,
 	}
-
-	globalBloomFilter.bfMap.m[userID] = &BloomFilter{
-		filter: make([]byte, size),
-		size:   size,
+	for i := range bfpu.shards {
+		bfpu.shards[i] = &filterShard{
+			m: make(map[int64]*ScalableBloomFilter),
+		}
 	}
 
-	return &globalBloomFilter, nil
+	return bfpu, nil
 }
 
-func hashValueAndModBySize(key string, size int) int {
-	hasher := murmur3.New32()
-	_, _ = hasher.Write([]byte(key))
-	hash := hasher.Sum32()
-	return int(hash) % size
+func (bfpu *BloomFilterPerUser) shardFor(userID int64) *filterShard {
+	return bfpu.shards[uint64(userID)%shardCount]
 }
 
-func (bfpu *BloomFilterPerUser) AddToBloomFilterForUser(key string, userID string) error {
-
-	bf, exists := bfpu.bfMap.m[userID]
+// filterForUser returns the user's filter, creating it on first use. The
+// caller must hold the shard's write lock.
+func (bfpu *BloomFilterPerUser) filterForUser(shard *filterShard, userID int64) *ScalableBloomFilter {
+	bf, exists := shard.m[userID]
 	if !exists {
-		return fmt.Errorf("BloomFilter not found for user: %s", userID)
+		bf = newScalableBloomFilter(bfpu.cfg)
+		shard.m[userID] = bf
 	}
+	return bf
+}
 
-	idx := hashValueAndModBySize(key, bf.size)
+// Test reports whether key may already be in the user's filter. It never
+// modifies the filter.
+func (bfpu *BloomFilterPerUser) Test(userID int64, key int64) (bool, error) {
+	shard := bfpu.shardFor(userID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
 
-	byteIdx := idx / 8
-	bitIdx := idx % 8
-	bf.filter[byteIdx] |= 1 << bitIdx
+	bf, exists := shard.m[userID]
+	if !exists {
+		return false, nil
+	}
+	return bf.test(key), nil
+}
 
-	return nil
+func (bfpu *BloomFilterPerUser) Add(userID int64, key int64) error {
+	_, err := bfpu.TestAndAdd(userID, key)
+	return err
 }
 
-func (bfpu *BloomFilterPerUser) MembershipCheck(key string, userID string) (bool, error) {
-	bf, exists := bfpu.bfMap.m[userID]
+// TestAndAdd adds key to the user's filter and reports whether it may have
+// been present before, as a single atomic step.
+func (bfpu *BloomFilterPerUser) TestAndAdd(userID int64, key int64) (bool, error) {
+	shard := bfpu.shardFor(userID)
+	shard.mu.Lock()
 
-	if !exists {
-		_, err := NewBloomFilterForUser(1024, userID)
-		if err != nil {
-			return false, fmt.Errorf("failed to report false positive: %w", err)
-		}
-		bf, exists = bfpu.bfMap.m[userID]
-		if !exists {
-			return false, fmt.Errorf("error creating bloom filter for user: %w", err)
-		}
+	bf := bfpu.filterForUser(shard, userID)
+	if bf.test(key) {
+		shard.mu.Unlock()
+		return true, nil
 	}
+	grew := bf.add(key)
+	var event ResizeEvent
+	if grew {
+		event = bf.resizeEvent(userID)
+	}
+	shard.mu.Unlock()
 
-	idx := hashValueAndModBySize(key, bf.size)
-	byteIdx := idx / 8
-	bitIdx := idx % 8
-	if bf.filter[byteIdx]&(1<<bitIdx) != 0 {
-		return true, nil
+	if grew {
+		if err := bfpu.cfg.Notifier.NotifyResize(event); err != nil {
+			log.Printf("error notifying bloom filter resize for user %d: %v", userID, err)
+		}
 	}
+	return false, nil
+}
 
-	err := bfpu.AddToBloomFilterForUser(key, userID)
+// EstimatedFalsePositiveRate reports how saturated the user's filter is. A
+// user without a filter has seen nobody, so the rate is zero.
+func (bfpu *BloomFilterPerUser) EstimatedFalsePositiveRate(userID int64) (float64, error) {
+	shard := bfpu.shardFor(userID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
 
-	if err != nil {
-		return false, nil
+	bf, exists := shard.m[userID]
+	if !exists {
+		return 0, nil
 	}
-
-	return false, nil
+	return bf.EstimatedFalsePositiveRate(), nil
 }
 
-// func (bfpu *BloomFilterPerUser) checkFalsePositive(key string) error {
-// 	_, err := bfpu.queueConnForFalsePositives.Write([]byte(key))
-// 	if err != nil {
-// 		return fmt.Errorf("failed to send false positive to Kafka: %w", err)
-// 	}
-// 	return nil
-// }
-
-// func (bfpu *BloomFilterPerUser) changeUserFilterSize(userID string, size int) error {
-// 	bf, exists := bfpu.bfMap.m[userID]
-// 	if !exists {
-// 		return fmt.Errorf("BloomFilter not found for user: %s", userID)
-// 	}
-// 	bf.size = size
-// 	bf.filter = make([]byte, size)
-// 	return nil
-// }
+func (bfpu *BloomFilterPerUser) Reset(userID int64) error {
+	shard := bfpu.shardFor(userID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	delete(shard.m, userID)
+	return nil
+}
@@ -0,0 +1,96 @@
+package bloomfilter
+
+import (
+	"sync"
+	"testing"
+)
+
+// recordingNotifier keeps the resize events it is sent.
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []ResizeEvent
+}
+
+func (n *recordingNotifier) NotifyResize(event ResizeEvent) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event)
+	return nil
+}
+
+func TestBloomFilterPerUserTestAndAdd(t *testing.T) {
+	bf, err := NewBloomFilterPerUser(Config{ExpectedItems: 100, FPRate: 0.01})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if seen, err := bf.Test(1, 42); err != nil || seen {
+		t.Fatalf("Test on an empty filter = %v, %v", seen, err)
+	}
+	if seen, err := bf.TestAndAdd(1, 42); err != nil || seen {
+		t.Fatalf("first TestAndAdd = %v, %v, want false", seen, err)
+	}
+	if seen, err := bf.TestAndAdd(1, 42); err != nil || !seen {
+		t.Fatalf("second TestAndAdd = %v, %v, want true", seen, err)
+	}
+	if seen, _ := bf.Test(2, 42); seen {
+		t.Error("key added for user 1 is visible to user 2")
+	}
+
+	if err := bf.Reset(1); err != nil {
+		t.Fatal(err)
+	}
+	if seen, _ := bf.Test(1, 42); seen {
+		t.Error("key survived Reset")
+	}
+	if rate, _ := bf.EstimatedFalsePositiveRate(1); rate != 0 {
+		t.Errorf("false positive rate after Reset = %v, want 0", rate)
+	}
+}
+
+func TestBloomFilterPerUserGrows(t *testing.T) {
+	notifier := &recordingNotifier{}
+	bf, err := NewBloomFilterPerUser(Config{ExpectedItems: 50, FPRate: 0.01, Notifier: notifier})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 1000
+	for key := int64(0); key < n; key++ {
+		if err := bf.Add(7, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for key := int64(0); key < n; key++ {
+		if seen, _ := bf.Test(7, key); !seen {
+			t.Fatalf("false negative for key %d", key)
+		}
+	}
+
+	if len(notifier.events) == 0 {
+		t.Fatal("filter did not grow past its expected items")
+	}
+	for i, event := range notifier.events {
+		if event.UserID != 7 || event.Layer != i+1 {
+			t.Errorf("resize event %d = %+v", i, event)
+		}
+	}
+	// The compound rate stays bounded by FPRate / (1 - TighteningRatio).
+	if rate, _ := bf.EstimatedFalsePositiveRate(7); rate > 0.01/(1-defaultTighteningRatio) {
+		t.Errorf("false positive rate %v exceeds the bound", rate)
+	}
+}
+
+func TestNewBloomFilterPerUserRejectsInvalidConfig(t *testing.T) {
+	configs := []Config{
+		{ExpectedItems: 0, FPRate: 0.01},
+		{ExpectedItems: 100, FPRate: 1},
+		{ExpectedItems: 100, FPRate: 0.01, GrowthFactor: 0.5},
+		{ExpectedItems: 100, FPRate: 0.01, TighteningRatio: 1},
+	}
+	for _, cfg := range configs {
+		if _, err := NewBloomFilterPerUser(cfg); err == nil {
+			t.Errorf("config %+v accepted", cfg)
+		}
+	}
+}
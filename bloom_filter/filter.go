@@ -0,0 +1,109 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/spaolacci/murmur3"
+)
+
+// BloomFilter is a classic Bloom filter with m bits and k hash functions.
+// The k indexes are derived from a single 128-bit murmur3 hash using double
+// hashing: idx_i = h1 + i*h2 (mod m).
+type BloomFilter struct {
+	bits    []uint64
+	m       uint64
+	k       uint64
+	count   uint64
+	setBits uint64
+}
+
+// NewBloomFilter sizes a filter to hold expectedItems keys while keeping the
+// false-positive rate at or below fpRate.
+func NewBloomFilter(expectedItems uint, fpRate float64) (*BloomFilter, error) {
+	m, k, err := optimalParameters(expectedItems, fpRate)
+	if err != nil {
+		return nil, err
+	}
+	return &BloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}, nil
+}
+
+func optimalParameters(expectedItems uint, fpRate float64) (uint64, uint64, error) {
+	if expectedItems == 0 {
+		return 0, 0, fmt.Errorf("expected items must be positive")
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		return 0, 0, fmt.Errorf("false positive rate must be in (0, 1), got %v", fpRate)
+	}
+
+	n := float64(expectedItems)
+	m := math.Ceil(-n * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := math.Max(1, math.Round(m/n*math.Ln2))
+
+	return uint64(m), uint64(k), nil
+}
+
+func hashKey(key int64) (uint64, uint64) {
+	return murmur3.Sum128([]byte(strconv.FormatInt(key, 10)))
+}
+
+func locations(key int64, m uint64, k uint64) []uint64 {
+	h1, h2 := hashKey(key)
+	locs := make([]uint64, k)
+	for i := uint64(0); i < k; i++ {
+		locs[i] = (h1 + i*h2) % m
+	}
+	return locs
+}
+
+func (bf *BloomFilter) locations(key int64) []uint64 {
+	return locations(key, bf.m, bf.k)
+}
+
+// add sets key's bits. The count only grows when at least one bit flips, so
+// re-adding a key does not inflate the false-positive estimate.
+func (bf *BloomFilter) add(key int64) {
+	added := false
+	for _, loc := range bf.locations(key) {
+		word, mask := loc/64, uint64(1)<<(loc%64)
+		if bf.bits[word]&mask == 0 {
+			bf.bits[word] |= mask
+			bf.setBits++
+			added = true
+		}
+	}
+	if added {
+		bf.count++
+	}
+}
+
+func (bf *BloomFilter) test(key int64) bool {
+	for _, loc := range bf.locations(key) {
+		if bf.bits[loc/64]&(1<<(loc%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// EstimatedFalsePositiveRate returns the expected false-positive rate given
+// the number of keys added so far, (1 - e^(-kn/m))^k. Once it exceeds the
+// rate the filter was sized for, the filter is saturated.
+func (bf *BloomFilter) EstimatedFalsePositiveRate() float64 {
+	return estimatedFalsePositiveRate(bf.m, bf.k, bf.count)
+}
+
+// FillRatio is the fraction of bits that are set.
+func (bf *BloomFilter) FillRatio() float64 {
+	return float64(bf.setBits) / float64(bf.m)
+}
+
+func estimatedFalsePositiveRate(m uint64, k uint64, count uint64) float64 {
+	exponent := -float64(k) * float64(count) / float64(m)
+	return math.Pow(1-math.Exp(exponent), float64(k))
+}
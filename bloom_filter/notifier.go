@@ -0,0 +1,72 @@
+package bloomfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ResizeEvent is emitted whenever a user's filter gains a new layer.
+type ResizeEvent struct {
+	UserID   int64   `json:"user_id"`
+	Layer    int     `json:"layer"`
+	Capacity uint    `json:"capacity"`
+	FPRate   float64 `json:"fp_rate"`
+}
+
+type ResizeNotifier interface {
+	NotifyResize(event ResizeEvent) error
+}
+
+type NopNotifier struct{}
+
+func (NopNotifier) NotifyResize(ResizeEvent) error {
+	return nil
+}
+
+type LogNotifier struct{}
+
+func (LogNotifier) NotifyResize(event ResizeEvent) error {
+	log.Printf("bloom filter for user %d grew to layer %d (capacity %d, fp rate %v)",
+		event.UserID, event.Layer, event.Capacity, event.FPRate)
+	return nil
+}
+
+// notifyTimeout bounds a resize publish. Resizes are announced from inside
+// feed and swipe requests, which must not hang on a stalled broker; a
+// dropped event only costs an observer an update.
+const notifyTimeout = time.Second
+
+// KafkaNotifier publishes resize events as JSON on the connection's topic.
+type KafkaNotifier struct {
+	mu   sync.Mutex
+	conn *kafka.Conn
+}
+
+func NewKafkaNotifier(conn *kafka.Conn) *KafkaNotifier {
+	return &KafkaNotifier{conn: conn}
+}
+
+func (kn *KafkaNotifier) NotifyResize(event ResizeEvent) error {
+	msg, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	kn.mu.Lock()
+	defer kn.mu.Unlock()
+	if err := kn.conn.SetWriteDeadline(time.Now().Add(notifyTimeout)); err != nil {
+		return err
+	}
+	if _, err := kn.conn.Write(msg); err != nil {
+		return fmt.Errorf("failed to send filter resize to Kafka: %w", err)
+	}
+	return nil
+}
+
+func (kn *KafkaNotifier) Close() error {
+	return kn.conn.Close()
+}
@@ -0,0 +1,85 @@
+package bloomfilter
+
+import (
+	"binge/db"
+	"binge/db/migr"
+	"context"
+	"fmt"
+	"log"
+)
+
+const rebuildPageSize = 1000
+
+// Rebuild resets the user's filter and repopulates it from the swipes table,
+// paging through the user's swipes by ID. Until it finishes the user may be
+// shown profiles they have already swiped on. It returns the number of swipes
+// replayed.
+func Rebuild(ctx context.Context, database *db.DB, store Store, userID int64) (int, error) {
+	if err := store.Reset(userID); err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	var lastID int64
+	for {
+		swipes, err := database.ListSwipedOnByUser(ctx, migr.ListSwipedOnByUserParams{
+			UserSwiped: userID,
+			ID:         lastID,
+			Limit:      rebuildPageSize,
+		})
+		if err != nil {
+			return replayed, fmt.Errorf("error listing swipes for user %d: %w", userID, err)
+		}
+
+		for _, swipe := range swipes {
+			if err := store.Add(userID, swipe.UserSwipedOn); err != nil {
+				return replayed, err
+			}
+			replayed++
+		}
+
+		if len(swipes) < rebuildPageSize {
+			return replayed, nil
+		}
+		lastID = swipes[len(swipes)-1].ID
+	}
+}
+
+// RebuildAll rebuilds every user's filter. A failure for one user is logged
+// and does not stop the others; the number of failures is reported at the end.
+func RebuildAll(ctx context.Context, database *db.DB, store Store) error {
+	failed := 0
+	var lastID int64
+	for {
+		userIDs, err := database.ListUserIDs(ctx, migr.ListUserIDsParams{
+			ID:    lastID,
+			Limit: rebuildPageSize,
+		})
+		if err != nil {
+			return fmt.Errorf("error listing users: %w", err)
+		}
+
+		for _, userID := range userIDs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			replayed, err := Rebuild(ctx, database, store, userID)
+			if err != nil {
+				log.Printf("error rebuilding bloom filter for user %d: %v", userID, err)
+				failed++
+				continue
+			}
+			log.Printf("rebuilt bloom filter for user %d from %d swipes", userID, replayed)
+		}
+
+		if len(userIDs) < rebuildPageSize {
+			break
+		}
+		lastID = userIDs[len(userIDs)-1]
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to rebuild bloom filters for %d users", failed)
+	}
+	return nil
+}
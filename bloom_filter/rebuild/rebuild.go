@@ -0,0 +1,50 @@
+package main
+
+import (
+	bloomfilter "binge/bloom_filter"
+	"binge/cache"
+	"binge/config"
+	"binge/db"
+	"context"
+	"flag"
+	"log"
+	"os"
+)
+
+func main() {
+	userID := flag.Int64("user", 0, "rebuild only this user's filter instead of every user's")
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	database, err := db.NewDB(cfg.MySQL.User, cfg.MySQL.Password, cfg.MySQL.Addr, cfg.MySQL.Database)
+	if err != nil {
+		log.Fatalf("Error setting up DB: %v", err)
+	}
+
+	redis := cache.NewCache(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB)
+	store, err := bloomfilter.NewRedisStore(redis, bloomfilter.Config{
+		ExpectedItems: cfg.BloomFilter.ExpectedItems,
+		FPRate:        cfg.BloomFilter.FPRate,
+		Notifier:      bloomfilter.LogNotifier{},
+	})
+	if err != nil {
+		log.Fatalf("Error setting up bloom filter store: %v", err)
+	}
+
+	ctx := context.Background()
+	if *userID != 0 {
+		replayed, err := bloomfilter.Rebuild(ctx, database, store, *userID)
+		if err != nil {
+			log.Fatalf("Error rebuilding bloom filter for user %d: %v", *userID, err)
+		}
+		log.Printf("Rebuilt bloom filter for user %d from %d swipes", *userID, replayed)
+		return
+	}
+
+	if err := bloomfilter.RebuildAll(ctx, database, store); err != nil {
+		log.Fatalf("Error rebuilding bloom filters: %v", err)
+	}
+	log.Println("Rebuilt all bloom filters")
+}
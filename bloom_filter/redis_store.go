@@ -0,0 +1,223 @@
+package bloomfilter
+
+import (
+	"binge/cache"
+	"fmt"
+	"log"
+
+	"github.com/go-redis/redis"
+)
+
+// growLayersScript bumps the layer count only if no other replica has done
+// so already, so concurrent writers crossing the threshold add one layer.
+const growLayersScript = `
+local current = tonumber(redis.call('GET', KEYS[1]) or '1')
+if current == tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[1], ARGV[1] + 1)
+	return 1
+end
+return 0
+`
+
+// RedisStore keeps each user's scalable filter as a set of Redis bitmaps, one
+// per layer, so seen-sets survive restarts and are shared by every API
+// replica. Bits are set with SETBIT and read with GETBIT; the layer count and
+// a per-layer counter for the false-positive estimate live next to them.
+type RedisStore struct {
+	cache *cache.Cache
+	cfg   Config
+}
+
+func NewRedisStore(c *cache.Cache, cfg Config) (*RedisStore, error) {
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStore{
+		cache: c,
+		cfg:   cfg,
+	}, nil
+}
+
+func layersKey(userID int64) string {
+	return fmt.Sprintf("bloom:%d:layers", userID)
+}
+
+func layerKey(userID int64, layer int) string {
+	return fmt.Sprintf("bloom:%d:%d", userID, layer)
+}
+
+func countKey(userID int64, layer int) string {
+	return fmt.Sprintf("bloom:%d:%d:count", userID, layer)
+}
+
+func (rs *RedisStore) layerParameters(layer int) (uint64, uint64) {
+	capacity, fpRate := rs.cfg.layer(layer)
+	// Layer parameters are validated by Config.withDefaults.
+	m, k, _ := optimalParameters(capacity, fpRate)
+	return m, k
+}
+
+func (rs *RedisStore) layers(userID int64) (int, error) {
+	n, err := rs.cache.R.Get(layersKey(userID)).Int()
+	if err == redis.Nil {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading bloom filter layers for user %d: %w", userID, err)
+	}
+	return n, nil
+}
+
+func (rs *RedisStore) Test(userID int64, key int64) (bool, error) {
+	n, err := rs.layers(userID)
+	if err != nil {
+		return false, err
+	}
+
+	pipe := rs.cache.R.Pipeline()
+	cmds := make([][]*redis.IntCmd, n)
+	for layer := 0; layer < n; layer++ {
+		m, k := rs.layerParameters(layer)
+		for _, loc := range locations(key, m, k) {
+			cmds[layer] = append(cmds[layer], pipe.GetBit(layerKey(userID, layer), int64(loc)))
+		}
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return false, fmt.Errorf("error reading bloom filter for user %d: %w", userID, err)
+	}
+
+	for _, layer := range cmds {
+		if allSet(layer) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (rs *RedisStore) Add(userID int64, key int64) error {
+	_, err := rs.TestAndAdd(userID, key)
+	return err
+}
+
+// TestAndAdd checks every layer and, if key is new, sets its bits in the
+// newest layer in one MULTI/EXEC. When that layer's fill ratio crosses the
+// threshold a new layer is chained on and the notifier is told.
+func (rs *RedisStore) TestAndAdd(userID int64, key int64) (bool, error) {
+	present, err := rs.Test(userID, key)
+	if err != nil || present {
+		return present, err
+	}
+
+	n, err := rs.layers(userID)
+	if err != nil {
+		return false, err
+	}
+	current := n - 1
+	m, k := rs.layerParameters(current)
+
+	pipe := rs.cache.R.TxPipeline()
+	var cmds []*redis.IntCmd
+	for _, loc := range locations(key, m, k) {
+		cmds = append(cmds, pipe.SetBit(layerKey(userID, current), int64(loc), 1))
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return false, fmt.Errorf("error updating bloom filter for user %d: %w", userID, err)
+	}
+	if allSet(cmds) {
+		return true, nil
+	}
+
+	if err := rs.cache.R.Incr(countKey(userID, current)).Err(); err != nil {
+		return false, fmt.Errorf("error updating bloom filter count for user %d: %w", userID, err)
+	}
+
+	setBits, err := rs.cache.R.BitCount(layerKey(userID, current), nil).Result()
+	if err != nil {
+		return false, fmt.Errorf("error reading bloom filter fill for user %d: %w", userID, err)
+	}
+	if float64(setBits)/float64(m) >= rs.cfg.FillThreshold {
+		if err := rs.grow(userID, n); err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+func (rs *RedisStore) grow(userID int64, n int) error {
+	grew, err := rs.cache.R.Eval(growLayersScript, []string{layersKey(userID)}, n).Int()
+	if err != nil {
+		return fmt.Errorf("error growing bloom filter for user %d: %w", userID, err)
+	}
+	if grew == 0 {
+		return nil
+	}
+
+	capacity, fpRate := rs.cfg.layer(n)
+	event := ResizeEvent{
+		UserID:   userID,
+		Layer:    n,
+		Capacity: capacity,
+		FPRate:   fpRate,
+	}
+	if err := rs.cfg.Notifier.NotifyResize(event); err != nil {
+		log.Printf("error notifying bloom filter resize for user %d: %v", userID, err)
+	}
+	return nil
+}
+
+func (rs *RedisStore) EstimatedFalsePositiveRate(userID int64) (float64, error) {
+	n, err := rs.layers(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	pipe := rs.cache.R.Pipeline()
+	cmds := make([]*redis.StringCmd, n)
+	for layer := 0; layer < n; layer++ {
+		cmds[layer] = pipe.Get(countKey(userID, layer))
+	}
+	if _, err := pipe.Exec(); err != nil && err != redis.Nil {
+		return 0, fmt.Errorf("error reading bloom filter count for user %d: %w", userID, err)
+	}
+
+	miss := 1.0
+	for layer, cmd := range cmds {
+		count, err := cmd.Uint64()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error reading bloom filter count for user %d: %w", userID, err)
+		}
+		m, k := rs.layerParameters(layer)
+		miss *= 1 - estimatedFalsePositiveRate(m, k, count)
+	}
+	return 1 - miss, nil
+}
+
+func (rs *RedisStore) Reset(userID int64) error {
+	n, err := rs.layers(userID)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{layersKey(userID)}
+	for layer := 0; layer < n; layer++ {
+		keys = append(keys, layerKey(userID, layer), countKey(userID, layer))
+	}
+	if err := rs.cache.R.Del(keys...).Err(); err != nil {
+		return fmt.Errorf("error resetting bloom filter for user %d: %w", userID, err)
+	}
+	return nil
+}
+
+func allSet(cmds []*redis.IntCmd) bool {
+	for _, cmd := range cmds {
+		if cmd.Val() == 0 {
+			return false
+		}
+	}
+	return true
+}
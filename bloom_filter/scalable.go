@@ -0,0 +1,127 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	defaultGrowthFactor    = 2
+	defaultTighteningRatio = 0.8
+	defaultFillThreshold   = 0.5
+)
+
+// Config describes a scalable Bloom filter. The first layer is sized for
+// ExpectedItems at FPRate. Once a layer's fill ratio crosses FillThreshold a
+// new layer is chained on, GrowthFactor times larger and with its
+// false-positive rate multiplied by TighteningRatio, which keeps the compound
+// rate bounded by FPRate / (1 - TighteningRatio).
+type Config struct {
+	ExpectedItems   uint
+	FPRate          float64
+	GrowthFactor    float64
+	TighteningRatio float64
+	FillThreshold   float64
+	Notifier        ResizeNotifier
+}
+
+func (c Config) withDefaults() (Config, error) {
+	if c.GrowthFactor == 0 {
+		c.GrowthFactor = defaultGrowthFactor
+	}
+	if c.TighteningRatio == 0 {
+		c.TighteningRatio = defaultTighteningRatio
+	}
+	if c.FillThreshold == 0 {
+		c.FillThreshold = defaultFillThreshold
+	}
+	if c.Notifier == nil {
+		c.Notifier = NopNotifier{}
+	}
+
+	if _, _, err := optimalParameters(c.ExpectedItems, c.FPRate); err != nil {
+		return c, err
+	}
+	if c.GrowthFactor < 1 {
+		return c, fmt.Errorf("growth factor must be at least 1, got %v", c.GrowthFactor)
+	}
+	if c.TighteningRatio <= 0 || c.TighteningRatio >= 1 {
+		return c, fmt.Errorf("tightening ratio must be in (0, 1), got %v", c.TighteningRatio)
+	}
+	if c.FillThreshold <= 0 || c.FillThreshold >= 1 {
+		return c, fmt.Errorf("fill threshold must be in (0, 1), got %v", c.FillThreshold)
+	}
+	return c, nil
+}
+
+// layer returns the capacity and false-positive rate of the i-th layer.
+func (c Config) layer(i int) (uint, float64) {
+	capacity := float64(c.ExpectedItems) * math.Pow(c.GrowthFactor, float64(i))
+	fpRate := c.FPRate * math.Pow(c.TighteningRatio, float64(i))
+	return uint(math.Ceil(capacity)), fpRate
+}
+
+// ScalableBloomFilter chains Bloom filters of increasing size. Keys are only
+// ever added to the newest layer; lookups check every layer.
+type ScalableBloomFilter struct {
+	cfg    Config
+	layers []*BloomFilter
+}
+
+func newScalableBloomFilter(cfg Config) *ScalableBloomFilter {
+	sbf := &ScalableBloomFilter{cfg: cfg}
+	sbf.grow()
+	return sbf
+}
+
+func (sbf *ScalableBloomFilter) grow() {
+	capacity, fpRate := sbf.cfg.layer(len(sbf.layers))
+	// Layer parameters are validated by Config.withDefaults.
+	bf, _ := NewBloomFilter(capacity, fpRate)
+	sbf.layers = append(sbf.layers, bf)
+}
+
+func (sbf *ScalableBloomFilter) test(key int64) bool {
+	for _, layer := range sbf.layers {
+		if layer.test(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// add inserts key into the newest layer and reports whether that pushed the
+// filter over its fill threshold and a new layer was chained on.
+func (sbf *ScalableBloomFilter) add(key int64) bool {
+	if sbf.test(key) {
+		return false
+	}
+	current := sbf.layers[len(sbf.layers)-1]
+	current.add(key)
+	if current.FillRatio() < sbf.cfg.FillThreshold {
+		return false
+	}
+	sbf.grow()
+	return true
+}
+
+// EstimatedFalsePositiveRate combines the per-layer estimates: a key is a
+// false positive if any layer reports it.
+func (sbf *ScalableBloomFilter) EstimatedFalsePositiveRate() float64 {
+	miss := 1.0
+	for _, layer := range sbf.layers {
+		miss *= 1 - layer.EstimatedFalsePositiveRate()
+	}
+	return 1 - miss
+}
+
+func (sbf *ScalableBloomFilter) resizeEvent(userID int64) ResizeEvent {
+	layer := len(sbf.layers) - 1
+	capacity, fpRate := sbf.cfg.layer(layer)
+	return ResizeEvent{
+		UserID:   userID,
+		Layer:    layer,
+		Capacity: capacity,
+		FPRate:   fpRate,
+	}
+}
@@ -0,0 +1,17 @@
+package bloomfilter
+
+// Store keeps one Bloom filter per user, recording which profiles that user
+// has already been shown or swiped on.
+type Store interface {
+	Test(userID int64, key int64) (bool, error)
+	Add(userID int64, key int64) error
+	TestAndAdd(userID int64, key int64) (bool, error)
+	EstimatedFalsePositiveRate(userID int64) (float64, error)
+	// Reset drops the user's filter so it can be rebuilt from scratch.
+	Reset(userID int64) error
+}
+
+var (
+	_ Store = (*BloomFilterPerUser)(nil)
+	_ Store = (*RedisStore)(nil)
+)
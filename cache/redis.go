@@ -1,7 +1,7 @@
 package cache
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/go-redis/redis"
 )
@@ -10,14 +10,22 @@ type Cache struct {
 	R *redis.Client
 }
 
-func NewCache(port string) *Cache {
+func NewCache(addr string, password string, db int) *Cache {
 	rdb := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("localhost:%s", port),
-		Password: "",
-		DB:       0,
+		Addr:     addr,
+		Password: password,
+		DB:       db,
 	})
 	c := &Cache{
 		R: rdb,
 	}
 	return c
 }
+
+func (c *Cache) Close() error {
+	return c.R.Close()
+}
+
+func (c *Cache) Ping(ctx context.Context) error {
+	return c.R.WithContext(ctx).Ping().Err()
+}
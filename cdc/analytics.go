@@ -0,0 +1,110 @@
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// SwipesTransformer maps swipes change events to documents in an analytics
+// index, denormalized with the locations of the swiper and the user swiped
+// on.
+type SwipesTransformer struct {
+	Index string
+	Users LocationLookup
+}
+
+func (t SwipesTransformer) Transform(ctx context.Context, rec *Record) ([]Operation, error) {
+	return pairOperations(ctx, rec, t.Index, t.Users, func(row map[string]interface{}) (map[string]interface{}, userLocations) {
+		doc := map[string]interface{}{
+			"id":           row["id"],
+			"swiper_id":    row["user_swiped"],
+			"swiped_on_id": row["user_swiped_on"],
+			"direction":    row["swipe_type"],
+			"created_at":   row["created_at"],
+		}
+		return doc, userLocations{
+			"swiper_location":    row["user_swiped"],
+			"swiped_on_location": row["user_swiped_on"],
+		}
+	})
+}
+
+// MatchesTransformer maps matches change events to documents in an
+// analytics index, denormalized with the locations of both users.
+type MatchesTransformer struct {
+	Index string
+	Users LocationLookup
+}
+
+func (t MatchesTransformer) Transform(ctx context.Context, rec *Record) ([]Operation, error) {
+	return pairOperations(ctx, rec, t.Index, t.Users, func(row map[string]interface{}) (map[string]interface{}, userLocations) {
+		doc := map[string]interface{}{
+			"id":         row["id"],
+			"user_id_1":  row["user_id_1"],
+			"user_id_2":  row["user_id_2"],
+			"created_at": row["created_at"],
+		}
+		return doc, userLocations{
+			"user_1_location": row["user_id_1"],
+			"user_2_location": row["user_id_2"],
+		}
+	})
+}
+
+// userLocations maps document fields to the user IDs whose locations fill
+// them.
+type userLocations map[string]interface{}
+
+// pairOperations maps a change event on a table relating two users to an
+// operation on the row's document: the document built by toDoc is indexed
+// with the users' locations added, or deleted along with the row. A user
+// missing from the lookup, say one whose own change has not been indexed
+// yet, leaves the field out rather than holding the event back.
+func pairOperations(ctx context.Context, rec *Record, index string, users LocationLookup,
+	toDoc func(row map[string]interface{}) (map[string]interface{}, userLocations)) ([]Operation, error) {
+	event, err := ParseChangeEvent(rec.Value)
+	if err != nil || event == nil {
+		return nil, err
+	}
+
+	if event.Op == OpDelete {
+		id, err := RecordID(event.Before)
+		if err != nil {
+			return nil, err
+		}
+		return []Operation{{Action: "delete", Index: index, DocumentID: id}}, nil
+	}
+
+	id, err := RecordID(event.After)
+	if err != nil {
+		return nil, err
+	}
+	doc, fields := toDoc(event.After)
+
+	userIDs := make(map[string]string, len(fields))
+	var ids []string
+	for field, value := range fields {
+		userID, err := formatID(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+		userIDs[field] = userID
+		ids = append(ids, userID)
+	}
+	locations, err := users.Locations(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for field, userID := range userIDs {
+		if location, ok := locations[userID]; ok {
+			doc[field] = location
+		}
+	}
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return []Operation{{Action: "index", Index: index, DocumentID: id, Body: body}}, nil
+}
@@ -1,49 +1,50 @@
 package cdc
 
 import (
+	"binge/es"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"math/rand"
+	"math/big"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/tidwall/gjson"
 )
 
-func TransformCreateOperationForES(record map[string]interface{}) ([]byte, error) {
-	v, err := json.Marshal(record)
-	if err != nil {
-		return nil, err
-	}
-	lat := gjson.GetBytes(v, "latitude")
-	long := gjson.GetBytes(v, "longitude")
+const decimalSchemaName = "org.apache.kafka.connect.data.Decimal"
 
-	decodedLatitude, err := base64.StdEncoding.DecodeString(lat.String())
+func TransformCreateOperationForES(record map[string]interface{}, scales map[string]int) ([]byte, error) {
+	latitude, err := decimalField(record, scales, "latitude")
 	if err != nil {
 		return nil, err
 	}
-	decodedLongitude, err := base64.StdEncoding.DecodeString(long.String())
+	longitude, err := decimalField(record, scales, "longitude")
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println(decodedLatitude)
-	fmt.Println(decodedLongitude)
-
-	rand.Seed(time.Now().UnixNano())
-
-	latitude := rand.Float64()*180 - 90
-	longitude := rand.Float64()*360 - 180
+	location := es.GeoPoint{Lat: latitude, Lon: longitude}
+	if err := location.Validate(); err != nil {
+		return nil, fmt.Errorf("user %v: %w", record["id"], err)
+	}
 
 	esData := map[string]interface{}{
-		"id":         record["id"],
-		"first_name": record["first_name"],
-		"last_name":  record["last_name"],
-		"bio":        record["bio"],
-		"location_user": map[string]interface{}{
-			"lat": latitude,
-			"lon": longitude,
-		},
-		"updated_at": record["updated_at"],
+		"id":            record["id"],
+		"first_name":    record["first_name"],
+		"last_name":     record["last_name"],
+		"bio":           record["bio"],
+		"location_user": location,
+		"updated_at":    record["updated_at"],
+		"gender":        record["gender"],
+		"desirability":  record["desirability"],
+	}
+
+	if birthdate, ok := record["birthdate"].(float64); ok {
+		esData["birthdate"] = debeziumDate(birthdate)
+	}
+	if interestedIn, ok := record["interested_in"].(string); ok && interestedIn != "" {
+		esData["interested_in"] = strings.Split(interestedIn, ",")
 	}
 
 	data, err := json.Marshal(esData)
@@ -53,3 +54,84 @@ func TransformCreateOperationForES(record map[string]interface{}) ([]byte, error
 
 	return data, nil
 }
+
+// DecimalScales reads the scale of every DECIMAL column of the given envelope
+// field ("before" or "after") from the schema of a Debezium message. Columns
+// that Debezium did not encode as precise decimals are left out.
+func DecimalScales(message []byte, envelopeField string) (map[string]int, error) {
+	scales := make(map[string]int)
+	for _, envelope := range gjson.GetBytes(message, "schema.fields").Array() {
+		if envelope.Get("field").String() != envelopeField {
+			continue
+		}
+		for _, column := range envelope.Get("fields").Array() {
+			if column.Get("name").String() != decimalSchemaName {
+				continue
+			}
+			name := column.Get("field").String()
+			scale, err := strconv.Atoi(column.Get("parameters.scale").String())
+			if err != nil {
+				return nil, fmt.Errorf("invalid scale for decimal column %s: %w", name, err)
+			}
+			scales[name] = scale
+		}
+	}
+	return scales, nil
+}
+
+// DecodeDecimal decodes Debezium's precise decimal encoding: the base64 of the
+// unscaled value as a big-endian two's-complement integer, to be divided by
+// 10^scale.
+func DecodeDecimal(encoded string, scale int) (float64, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, fmt.Errorf("invalid decimal encoding: %w", err)
+	}
+	if len(raw) == 0 {
+		return 0, fmt.Errorf("empty decimal")
+	}
+
+	unscaled := new(big.Int).SetBytes(raw)
+	if raw[0]&0x80 != 0 {
+		// Negative: subtract 2^(8*len) to undo the two's complement.
+		unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(len(raw)*8)))
+	}
+
+	value := new(big.Float).SetInt(unscaled)
+	divisor := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+	f, _ := value.Quo(value, divisor).Float64()
+	return f, nil
+}
+
+// decimalField reads a DECIMAL column from a Debezium record. Besides the
+// precise encoding it accepts the double and string decimal.handling.mode
+// representations.
+func decimalField(record map[string]interface{}, scales map[string]int, column string) (float64, error) {
+	switch v := record[column].(type) {
+	case float64:
+		return v, nil
+	case string:
+		if scale, ok := scales[column]; ok {
+			f, err := DecodeDecimal(v, scale)
+			if err != nil {
+				return 0, fmt.Errorf("%s: %w", column, err)
+			}
+			return f, nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s: invalid decimal %q", column, v)
+		}
+		return f, nil
+	case nil:
+		return 0, fmt.Errorf("%s is missing", column)
+	default:
+		return 0, fmt.Errorf("%s: unsupported decimal value %v (%T)", column, v, v)
+	}
+}
+
+// debeziumDate converts an io.debezium.time.Date, the number of days since
+// the epoch, to the yyyy-MM-dd form the users index maps birthdate with.
+func debeziumDate(days float64) string {
+	return time.Unix(int64(days)*24*60*60, 0).UTC().Format("2006-01-02")
+}
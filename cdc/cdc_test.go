@@ -0,0 +1,151 @@
+package cdc
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readEnvelope loads a Debezium users change event from testdata and returns
+// the raw message along with its after row.
+func readEnvelope(t *testing.T, name string) ([]byte, map[string]interface{}) {
+	t.Helper()
+	message, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := ParseChangeEvent(message)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", name, err)
+	}
+	return message, event.After
+}
+
+func TestTransformCreateOperationForES(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		lat     float64
+		lon     float64
+		wantErr string
+	}{
+		{name: "precise, north and west", file: "users_precise_nyc.json", lat: 40.712776, lon: -74.005974},
+		{name: "precise, south and east", file: "users_precise_sydney.json", lat: -33.868820, lon: 151.209290},
+		{name: "precise, scale from schema", file: "users_precise_scale4.json", lat: 12.3456, lon: -1.5},
+		{name: "double handling mode", file: "users_double.json", lat: 51.507351, lon: -0.127758},
+		{name: "string handling mode", file: "users_string.json", lat: -22.906847, lon: -43.172896},
+		{name: "latitude out of range", file: "users_out_of_range.json", wantErr: "out of range"},
+		{name: "longitude missing", file: "users_missing_longitude.json", wantErr: "longitude is missing"},
+		{name: "latitude null", file: "users_null_latitude.json", wantErr: "latitude is missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, after := readEnvelope(t, tt.file)
+			scales, err := DecimalScales(message, "after")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := TransformCreateOperationForES(after, scales)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var doc struct {
+				Location struct {
+					Lat float64 `json:"lat"`
+					Lon float64 `json:"lon"`
+				} `json:"location_user"`
+				Birthdate    string   `json:"birthdate"`
+				InterestedIn []string `json:"interested_in"`
+			}
+			if err := json.Unmarshal(data, &doc); err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(doc.Location.Lat-tt.lat) > 1e-9 || math.Abs(doc.Location.Lon-tt.lon) > 1e-9 {
+				t.Errorf("got location (%v, %v), want (%v, %v)", doc.Location.Lat, doc.Location.Lon, tt.lat, tt.lon)
+			}
+			if doc.Birthdate != "1995-01-01" {
+				t.Errorf("got birthdate %q, want 1995-01-01", doc.Birthdate)
+			}
+			if strings.Join(doc.InterestedIn, ",") != "man,nonbinary" {
+				t.Errorf("got interested_in %v, want [man nonbinary]", doc.InterestedIn)
+			}
+		})
+	}
+}
+
+func TestDecimalScales(t *testing.T) {
+	tests := []struct {
+		file string
+		want map[string]int
+	}{
+		{file: "users_precise_nyc.json", want: map[string]int{"latitude": 6, "longitude": 6}},
+		{file: "users_precise_scale4.json", want: map[string]int{"latitude": 4, "longitude": 4}},
+		{file: "users_double.json", want: map[string]int{}},
+		{file: "users_string.json", want: map[string]int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			message, _ := readEnvelope(t, tt.file)
+			got, err := DecimalScales(message, "after")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got scales %v, want %v", got, tt.want)
+			}
+			for column, scale := range tt.want {
+				if got[column] != scale {
+					t.Errorf("got scale %d for %s, want %d", got[column], column, scale)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeDecimal(t *testing.T) {
+	tests := []struct {
+		encoded string
+		scale   int
+		want    float64
+		wantErr bool
+	}{
+		{encoded: "Am06SA==", scale: 6, want: 40.712776},
+		{encoded: "+5bCKg==", scale: 6, want: -74.005974},
+		{encoded: "AA==", scale: 6, want: 0},
+		{encoded: "/w==", scale: 2, want: -0.01},
+		{encoded: "AIA=", scale: 0, want: 128},
+		{encoded: "", scale: 6, wantErr: true},
+		{encoded: "not base64!", scale: 6, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoded, func(t *testing.T) {
+			got, err := DecodeDecimal(tt.encoded, tt.scale)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package cdc
+
+import (
+	"binge/config"
+	"binge/es"
+	"context"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// Consumer is the wiring of one table's CDC binary: the Debezium topic of
+// Table is streamed into Index, whose mapping is the one for Role.
+type Consumer struct {
+	Table string
+	Index string
+	Role  es.IndexRole
+	// NewTransformer builds the table's transformer once the client exists,
+	// for transformers that read other indices.
+	NewTransformer func(cl *elasticsearch.Client) Transformer
+}
+
+// TableConsumer returns the consumer of a table, writing to the index the
+// config names for it.
+func TableConsumer(cfg *config.Config, table string) (Consumer, error) {
+	users := cfg.Elasticsearch.Index
+	switch table {
+	case "users":
+		return Consumer{
+			Table: table,
+			Index: users,
+			Role:  es.RoleUsers,
+			NewTransformer: func(*elasticsearch.Client) Transformer {
+				return UsersTransformer{Index: users}
+			},
+		}, nil
+	case "swipes":
+		index := cfg.Elasticsearch.SwipesIndex
+		return Consumer{
+			Table: table,
+			Index: index,
+			Role:  es.RoleSwipes,
+			NewTransformer: func(cl *elasticsearch.Client) Transformer {
+				return SwipesTransformer{Index: index, Users: ESLocationLookup{Client: cl, Index: users}}
+			},
+		}, nil
+	case "matches":
+		index := cfg.Elasticsearch.MatchesIndex
+		return Consumer{
+			Table: table,
+			Index: index,
+			Role:  es.RoleMatches,
+			NewTransformer: func(cl *elasticsearch.Client) Transformer {
+				return MatchesTransformer{Index: index, Users: ESLocationLookup{Client: cl, Index: users}}
+			},
+		}, nil
+	}
+	return Consumer{}, fmt.Errorf("unknown table %q, want users, swipes or matches", table)
+}
+
+// Run consumes the table's topic until ctx is cancelled, then flushes what
+// it has sent to Elasticsearch and commits the offsets that were
+// acknowledged. Records that keep failing go to the table's DLQ.
+func (c Consumer) Run(ctx context.Context, cfg *config.Config) error {
+	cl, err := es.NewElasticsearchClient(cfg.Elasticsearch.ClientConfig)
+	if err != nil {
+		return err
+	}
+	if err := es.EnsureIndex(cl, c.Index, c.Role); err != nil {
+		return fmt.Errorf("error creating index %s: %w", c.Index, err)
+	}
+	bi, err := es.NewBulkIndexer(cl, c.Index)
+	if err != nil {
+		return err
+	}
+
+	topic := cfg.CDC.Topic(c.Table)
+	dlq, err := NewDeadLetterSink(cfg.CDC.DLQFile, cfg.Kafka.BootstrapServers(), topic+".dlq")
+	if err != nil {
+		return err
+	}
+	defer dlq.Close()
+
+	source, err := NewKafkaSource(KafkaSourceConfig{
+		BootstrapServers: cfg.Kafka.BootstrapServers(),
+		GroupID:          "binge-" + c.Table + "-group",
+		Topics:           []string{topic},
+	})
+	if err != nil {
+		return err
+	}
+
+	pipeline := &Pipeline{
+		Name:           c.Table,
+		Source:         source,
+		Transformer:    c.NewTransformer(cl),
+		Sink:           NewESSink(bi),
+		DeadLetters:    dlq,
+		Backoff:        DefaultBackoff(),
+		CommitInterval: cfg.CDC.CommitInterval,
+	}
+	return pipeline.Run(ctx)
+}
@@ -0,0 +1,176 @@
+package cdc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// Stages at which a message can fail.
+const (
+	StageTransform = "transform"
+	StageIndex     = "index"
+)
+
+// DeadLetter is a message that could not be processed, along with where it
+// came from and why it failed. Key and Value hold the original bytes.
+type DeadLetter struct {
+	Topic     string    `json:"topic"`
+	Partition int32     `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Key       string    `json:"key,omitempty"`
+	Value     string    `json:"value"`
+	Stage     string    `json:"stage"`
+	Error     string    `json:"error"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// NewDeadLetter records rec as having failed at stage with err.
+func NewDeadLetter(rec *Record, stage string, err error) DeadLetter {
+	return DeadLetter{
+		Topic:     rec.Topic,
+		Partition: rec.Partition,
+		Offset:    rec.Offset,
+		Key:       string(rec.Key),
+		Value:     string(rec.Value),
+		Stage:     stage,
+		Error:     err.Error(),
+		FailedAt:  time.Now().UTC(),
+	}
+}
+
+// Record returns the record that failed.
+func (dl DeadLetter) Record() *Record {
+	return &Record{
+		Topic:     dl.Topic,
+		Partition: dl.Partition,
+		Offset:    dl.Offset,
+		Key:       []byte(dl.Key),
+		Value:     []byte(dl.Value),
+	}
+}
+
+// DeadLetterSink stores dead letters for later replay. Send must be safe to
+// call from BulkIndexer callbacks running on other goroutines.
+type DeadLetterSink interface {
+	Send(dl DeadLetter) error
+	Close() error
+}
+
+// FileSink appends dead letters to a file as JSON lines.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead letter file: %w", err)
+	}
+	return &FileSink{file: file}, nil
+}
+
+func (fs *FileSink) Send(dl DeadLetter) error {
+	line, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, err := fs.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write dead letter: %w", err)
+	}
+	return nil
+}
+
+func (fs *FileSink) Close() error {
+	return fs.file.Close()
+}
+
+// ReadDeadLetterFile returns every dead letter a FileSink wrote to path.
+func ReadDeadLetterFile(path string) ([]DeadLetter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var letters []DeadLetter
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var dl DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &dl); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		letters = append(letters, dl)
+	}
+	return letters, scanner.Err()
+}
+
+// KafkaSink publishes dead letters as JSON on a topic, keyed by the original
+// message key so that a row's failures stay in order.
+type KafkaSink struct {
+	producer *kafka.Producer
+	topic    string
+}
+
+func NewKafkaSink(bootstrapServers string, topic string) (*KafkaSink, error) {
+	p, err := kafka.NewProducer(&kafka.ConfigMap{
+		"bootstrap.servers": bootstrapServers,
+		"acks":              "all",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dead letter producer: %w", err)
+	}
+	return &KafkaSink{producer: p, topic: topic}, nil
+}
+
+// Send waits for the broker to acknowledge the dead letter, so a message is
+// never skipped without having been stored.
+func (ks *KafkaSink) Send(dl DeadLetter) error {
+	value, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+
+	delivery := make(chan kafka.Event, 1)
+	err = ks.producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &ks.topic, Partition: kafka.PartitionAny},
+		Key:            []byte(dl.Key),
+		Value:          value,
+	}, delivery)
+	if err != nil {
+		return fmt.Errorf("failed to send dead letter to Kafka: %w", err)
+	}
+
+	m := (<-delivery).(*kafka.Message)
+	if m.TopicPartition.Error != nil {
+		return fmt.Errorf("failed to send dead letter to Kafka: %w", m.TopicPartition.Error)
+	}
+	return nil
+}
+
+func (ks *KafkaSink) Close() error {
+	ks.producer.Flush(10 * 1000)
+	ks.producer.Close()
+	return nil
+}
+
+// NewDeadLetterSink returns a FileSink writing to file if it is set, and
+// otherwise a KafkaSink publishing to topic.
+func NewDeadLetterSink(file string, bootstrapServers string, topic string) (DeadLetterSink, error) {
+	if file != "" {
+		return NewFileSink(file)
+	}
+	return NewKafkaSink(bootstrapServers, topic)
+}
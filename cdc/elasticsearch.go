@@ -0,0 +1,74 @@
+package cdc
+
+import (
+	"binge/es"
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+)
+
+// ESSink applies operations through a BulkIndexer. Writes carry their
+// version as an external version, so Elasticsearch itself rejects stale
+// ones, however the BulkIndexer's workers order them.
+//
+// Deletes replace the document with a tombstone rather than removing it.
+// Elasticsearch forgets the version of a removed document after
+// index.gc_deletes (60s by default), after which a dead letter replayed
+// hours later would bring a deleted row back; a tombstone keeps rejecting
+// it for good. Searches filter tombstones out by es.DeletedField.
+type ESSink struct {
+	bi esutil.BulkIndexer
+}
+
+func NewESSink(bi esutil.BulkIndexer) *ESSink {
+	return &ESSink{bi: bi}
+}
+
+var tombstone = []byte(`{"` + es.DeletedField + `":true}`)
+
+func (s *ESSink) Write(ctx context.Context, op Operation, done func(error)) error {
+	if op.Action == "delete" {
+		op.Action, op.Body = "index", tombstone
+	}
+	item := esutil.BulkIndexerItem{
+		Index:       op.Index,
+		Action:      op.Action,
+		DocumentID:  op.DocumentID,
+		Version:     &op.Version,
+		VersionType: "external",
+		OnSuccess: func(context.Context, esutil.BulkIndexerItem, esutil.BulkIndexerResponseItem) {
+			done(nil)
+		},
+		OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+			done(indexFailure(item, res, err))
+		},
+	}
+	if op.Body != nil {
+		item.Body = bytes.NewReader(op.Body)
+	}
+	return s.bi.Add(ctx, item)
+}
+
+func (s *ESSink) Close(ctx context.Context) error {
+	return s.bi.Close(ctx)
+}
+
+// indexFailure turns a BulkIndexer failure into an error, or nil if it needs
+// no handling: a version conflict means a write at least as recent got there
+// first. Transport errors, throttling and server errors are transient;
+// rejected documents are not.
+func indexFailure(item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) error {
+	if err != nil {
+		return &TransientError{Err: err}
+	}
+	if res.Status == 409 {
+		return nil
+	}
+	err = fmt.Errorf("elasticsearch %s error (%d): %s: %s", item.Action, res.Status, res.Error.Type, res.Error.Reason)
+	if res.Status == 429 || res.Status >= 500 {
+		return &TransientError{Err: err}
+	}
+	return err
+}
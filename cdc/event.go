@@ -0,0 +1,79 @@
+package cdc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Debezium change event operations.
+const (
+	OpCreate = "c"
+	OpUpdate = "u"
+	OpRead   = "r"
+	OpDelete = "d"
+)
+
+// ChangeEvent is the payload of a Debezium change event. Before is nil for
+// creates and snapshot reads; After is nil for deletes.
+type ChangeEvent struct {
+	Op     string                 `json:"op"`
+	Before map[string]interface{} `json:"before"`
+	After  map[string]interface{} `json:"after"`
+}
+
+// ParseChangeEvent decodes a Debezium message value. Tombstones, the empty
+// values Debezium emits after a delete so that log compaction can drop the
+// key, yield a nil event and no error.
+func ParseChangeEvent(value []byte) (*ChangeEvent, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	var message struct {
+		Payload *ChangeEvent `json:"payload"`
+	}
+	if err := json.Unmarshal(value, &message); err != nil {
+		return nil, fmt.Errorf("error unmarshaling message: %w", err)
+	}
+	if message.Payload == nil {
+		return nil, fmt.Errorf("message has no payload")
+	}
+
+	event := message.Payload
+	switch event.Op {
+	case OpCreate, OpUpdate, OpRead:
+		if event.After == nil {
+			return nil, fmt.Errorf("%q event has no 'after' row", event.Op)
+		}
+	case OpDelete:
+		if event.Before == nil {
+			return nil, fmt.Errorf("delete event has no 'before' row")
+		}
+	default:
+		return nil, fmt.Errorf("unknown operation %q", event.Op)
+	}
+	return event, nil
+}
+
+// RecordID returns a row's primary key in the form used as the Elasticsearch
+// document ID.
+func RecordID(record map[string]interface{}) (string, error) {
+	id, err := formatID(record["id"])
+	if err != nil {
+		return "", fmt.Errorf("record has no usable id: %w", err)
+	}
+	return id, nil
+}
+
+// formatID formats a BIGINT column value, which JSON decodes as a float64.
+func formatID(value interface{}) (string, error) {
+	switch id := value.(type) {
+	case float64:
+		return strconv.FormatInt(int64(id), 10), nil
+	case string:
+		return id, nil
+	default:
+		return "", fmt.Errorf("invalid id %v", value)
+	}
+}
@@ -0,0 +1,130 @@
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+const kafkaPollInterval = time.Second
+
+type KafkaSourceConfig struct {
+	BootstrapServers string
+	GroupID          string
+	Topics           []string
+	// IdleTimeout, if set, ends the source once no message has arrived for
+	// that long. Long-running consumers leave it unset.
+	IdleTimeout time.Duration
+}
+
+// KafkaSource reads records from a consumer group with auto-commit off.
+// Commit only advances a partition past records that have been acknowledged,
+// along with everything read before them.
+type KafkaSource struct {
+	consumer    *kafka.Consumer
+	offsets     *OffsetTracker
+	idleTimeout time.Duration
+	lastMessage time.Time
+}
+
+func NewKafkaSource(cfg KafkaSourceConfig) (*KafkaSource, error) {
+	c, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers":  cfg.BootstrapServers,
+		"group.id":           cfg.GroupID,
+		"auto.offset.reset":  "earliest",
+		"enable.auto.commit": false,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &KafkaSource{
+		consumer:    c,
+		offsets:     NewOffsetTracker(),
+		idleTimeout: cfg.IdleTimeout,
+		lastMessage: time.Now(),
+	}
+	err = c.SubscribeTopics(cfg.Topics, func(c *kafka.Consumer, ev kafka.Event) error {
+		if revoked, ok := ev.(kafka.RevokedPartitions); ok {
+			if err := s.Commit(); err != nil {
+				log.Printf("Error committing offsets of revoked partitions: %v", err)
+			}
+			s.offsets.Forget(revoked.Partitions)
+		}
+		return nil
+	})
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *KafkaSource) Read(ctx context.Context) (*Record, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	msg, err := s.consumer.ReadMessage(kafkaPollInterval)
+	if err != nil {
+		if kerr, ok := err.(kafka.Error); ok && kerr.Code() == kafka.ErrTimedOut {
+			if s.idleTimeout > 0 && time.Since(s.lastMessage) >= s.idleTimeout {
+				return nil, io.EOF
+			}
+			return nil, nil
+		}
+		return nil, err
+	}
+	s.lastMessage = time.Now()
+
+	return &Record{
+		Topic:     *msg.TopicPartition.Topic,
+		Partition: msg.TopicPartition.Partition,
+		Offset:    int64(msg.TopicPartition.Offset),
+		Key:       msg.Key,
+		Value:     msg.Value,
+		ack:       s.offsets.Track(msg.TopicPartition),
+	}, nil
+}
+
+func (s *KafkaSource) Commit() error {
+	offsets := s.offsets.Committable()
+	if len(offsets) == 0 {
+		return nil
+	}
+	_, err := s.consumer.CommitOffsets(offsets)
+	return err
+}
+
+func (s *KafkaSource) Close() error {
+	return s.consumer.Close()
+}
+
+// DeadLetterSource reads dead letters from a source of DLQ messages and
+// yields the records they hold, so that they can be run through the
+// pipeline that failed them. Acknowledging a record acknowledges its DLQ
+// message.
+type DeadLetterSource struct {
+	Source
+}
+
+func (s DeadLetterSource) Read(ctx context.Context) (*Record, error) {
+	msg, err := s.Source.Read(ctx)
+	if msg == nil || err != nil {
+		return msg, err
+	}
+
+	var dl DeadLetter
+	if err := json.Unmarshal(msg.Value, &dl); err != nil {
+		log.Printf("Skipping unreadable dead letter %s[%d]@%d: %v", msg.Topic, msg.Partition, msg.Offset, err)
+		msg.Ack()
+		return nil, nil
+	}
+	rec := dl.Record()
+	rec.ack = msg.ack
+	return rec, nil
+}
@@ -0,0 +1,83 @@
+package cdc
+
+import (
+	"binge/es"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// LocationLookup finds users' locations by user ID. Users it does not know
+// are left out of the result.
+type LocationLookup interface {
+	Locations(ctx context.Context, ids []string) (map[string]es.GeoPoint, error)
+}
+
+// ESLocationLookup reads locations from the users index, whose document IDs
+// are user IDs.
+type ESLocationLookup struct {
+	Client *elasticsearch.Client
+	Index  string
+}
+
+func (l ESLocationLookup) Locations(ctx context.Context, ids []string) (map[string]es.GeoPoint, error) {
+	body, err := json.Marshal(map[string][]string{"ids": ids})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := l.Client.Mget(bytes.NewReader(body),
+		l.Client.Mget.WithContext(ctx),
+		l.Client.Mget.WithIndex(l.Index),
+		l.Client.Mget.WithSourceIncludes("location_user"),
+	)
+	if err != nil {
+		return nil, &TransientError{Err: fmt.Errorf("error looking up user locations: %w", err)}
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		err := fmt.Errorf("error looking up user locations: %s", res.String())
+		if res.StatusCode == 429 || res.StatusCode >= 500 {
+			return nil, &TransientError{Err: err}
+		}
+		return nil, err
+	}
+
+	var mget struct {
+		Docs []struct {
+			ID     string `json:"_id"`
+			Found  bool   `json:"found"`
+			Source struct {
+				LocationUser *es.GeoPoint `json:"location_user"`
+			} `json:"_source"`
+		} `json:"docs"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&mget); err != nil {
+		return nil, fmt.Errorf("error parsing user locations: %w", err)
+	}
+
+	locations := make(map[string]es.GeoPoint, len(mget.Docs))
+	for _, doc := range mget.Docs {
+		if doc.Found && doc.Source.LocationUser != nil {
+			locations[doc.ID] = *doc.Source.LocationUser
+		}
+	}
+	return locations, nil
+}
+
+// MemoryLocationLookup serves locations from a map keyed by user ID.
+type MemoryLocationLookup map[string]es.GeoPoint
+
+func (l MemoryLocationLookup) Locations(ctx context.Context, ids []string) (map[string]es.GeoPoint, error) {
+	locations := make(map[string]es.GeoPoint)
+	for _, id := range ids {
+		if p, ok := l[id]; ok {
+			locations[id] = p
+		}
+	}
+	return locations, nil
+}
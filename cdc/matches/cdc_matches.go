@@ -0,0 +1,28 @@
+package main
+
+import (
+	"binge/cdc"
+	"binge/config"
+	"binge/lifecycle"
+	"context"
+	"flag"
+	"log"
+	"os"
+)
+
+func main() {
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	consumer, err := cdc.TableConsumer(cfg, "matches")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := lifecycle.SignalContext(context.Background())
+	defer stop()
+	if err := consumer.Run(ctx, cfg); err != nil {
+		log.Fatalf("Error running matches pipeline: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// MemorySource yields a fixed list of records, then io.EOF.
+type MemorySource struct {
+	mu      sync.Mutex
+	records []*Record
+	next    int
+	acked   []int64
+}
+
+func NewMemorySource(records []*Record) *MemorySource {
+	return &MemorySource{records: records}
+}
+
+func (s *MemorySource) Read(ctx context.Context) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next == len(s.records) {
+		return nil, io.EOF
+	}
+	rec := s.records[s.next]
+	s.next++
+	rec.ack = func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.acked = append(s.acked, rec.Offset)
+	}
+	return rec, nil
+}
+
+// Acked returns the offsets of the records acknowledged so far, in the order
+// they were acknowledged.
+func (s *MemorySource) Acked() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.acked...)
+}
+
+func (s *MemorySource) Commit() error {
+	return nil
+}
+
+func (s *MemorySource) Close() error {
+	return nil
+}
+
+// MemorySink applies operations to in-memory indices synchronously. Like
+// ESSink, it drops writes whose version is not above the document's, and
+// keeps deleted documents as tombstones that still carry their version.
+type MemorySink struct {
+	mu      sync.Mutex
+	indices map[string]map[string]memoryDocument
+}
+
+type memoryDocument struct {
+	body    json.RawMessage
+	version int64
+	deleted bool
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{indices: make(map[string]map[string]memoryDocument)}
+}
+
+func (s *MemorySink) Write(ctx context.Context, op Operation, done func(error)) error {
+	s.mu.Lock()
+	docs, ok := s.indices[op.Index]
+	if !ok {
+		docs = make(map[string]memoryDocument)
+		s.indices[op.Index] = docs
+	}
+	if current, ok := docs[op.DocumentID]; !ok || op.Version > current.version {
+		if op.Action == "delete" {
+			docs[op.DocumentID] = memoryDocument{version: op.Version, deleted: true}
+		} else {
+			docs[op.DocumentID] = memoryDocument{body: append(json.RawMessage(nil), op.Body...), version: op.Version}
+		}
+	}
+	s.mu.Unlock()
+
+	done(nil)
+	return nil
+}
+
+// Document returns the document with the given ID, if the index has it.
+func (s *MemorySink) Document(index string, id string) (json.RawMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc, ok := s.indices[index][id]
+	if !ok || doc.deleted {
+		return nil, false
+	}
+	return doc.body, true
+}
+
+func (s *MemorySink) Close(ctx context.Context) error {
+	return nil
+}
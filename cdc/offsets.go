@@ -0,0 +1,93 @@
+package cdc
+
+import (
+	"sync"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// OffsetTracker works out which offsets are safe to commit when messages
+// finish out of order. A partition's offset only advances past a message
+// once it and every message read before it on that partition are done, so a
+// crash never skips a message whose processing was still in flight.
+type OffsetTracker struct {
+	mu         sync.Mutex
+	partitions map[partitionKey]*partitionOffsets
+}
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// partitionOffsets holds a partition's in-flight offsets in the order they
+// were read, which for a single partition is ascending.
+type partitionOffsets struct {
+	inFlight []int64
+	done     map[int64]bool
+	commit   kafka.Offset
+}
+
+func NewOffsetTracker() *OffsetTracker {
+	return &OffsetTracker{partitions: make(map[partitionKey]*partitionOffsets)}
+}
+
+// Track records that the message at tp has been read and returns the func
+// to call once it has been fully handled. Calls for a partition that has
+// since been forgotten are ignored.
+func (t *OffsetTracker) Track(tp kafka.TopicPartition) (done func()) {
+	key := partitionKey{topic: *tp.Topic, partition: tp.Partition}
+	offset := int64(tp.Offset)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[key]
+	if !ok {
+		p = &partitionOffsets{done: make(map[int64]bool), commit: kafka.OffsetInvalid}
+		t.partitions[key] = p
+	}
+	p.inFlight = append(p.inFlight, offset)
+
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		p.done[offset] = true
+	}
+}
+
+// Committable returns the offsets to commit for every partition that has
+// advanced since the last call. As Kafka expects, each is the offset of the
+// next message to read.
+func (t *OffsetTracker) Committable() []kafka.TopicPartition {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var offsets []kafka.TopicPartition
+	for key, p := range t.partitions {
+		advanced := false
+		for len(p.inFlight) > 0 && p.done[p.inFlight[0]] {
+			delete(p.done, p.inFlight[0])
+			p.commit = kafka.Offset(p.inFlight[0] + 1)
+			p.inFlight = p.inFlight[1:]
+			advanced = true
+		}
+		if advanced {
+			topic := key.topic
+			offsets = append(offsets, kafka.TopicPartition{Topic: &topic, Partition: key.partition, Offset: p.commit})
+		}
+	}
+	return offsets
+}
+
+// Forget drops the given partitions, typically because a rebalance revoked
+// them. Whatever was in flight on them will be redelivered to their new
+// owner.
+func (t *OffsetTracker) Forget(partitions []kafka.TopicPartition) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, tp := range partitions {
+		delete(t.partitions, partitionKey{topic: *tp.Topic, partition: tp.Partition})
+	}
+}
@@ -0,0 +1,246 @@
+package cdc
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Record is a message read from a Source.
+type Record struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+
+	ack func()
+}
+
+// Ack tells the record's source that it has been fully handled, either
+// written to the sink or dead-lettered.
+func (r *Record) Ack() {
+	if r.ack != nil {
+		r.ack()
+	}
+}
+
+// Operation is a write to a document in a sink. Body is unused by deletes.
+//
+// Version orders writes to the same document: a sink must drop a write whose
+// version is not above the document's current one, so that a retried or
+// reordered write cannot undo a later one. The pipeline sets it to the
+// record's offset, which only grows for a given document since Debezium
+// keys messages by primary key and so keeps a row's changes on one
+// partition.
+//
+// That only holds while a topic's partition count stays fixed. Adding
+// partitions moves keys to partitions with lower offsets, and every later
+// write to a moved document is then dropped as stale. Growing a CDC topic
+// therefore means recreating its indices and consuming from the start.
+type Operation struct {
+	Action     string
+	Index      string
+	DocumentID string
+	Body       []byte
+	Version    int64
+}
+
+// Source yields records to a Pipeline.
+//
+// Read blocks for at most a short poll interval: it returns a nil record and
+// nil error when nothing arrived in time, and io.EOF once the source is
+// exhausted. Commit persists the position of everything acknowledged so far.
+type Source interface {
+	Read(ctx context.Context) (*Record, error)
+	Commit() error
+	Close() error
+}
+
+// Transformer turns a record into the operations that apply it to a sink. A
+// record that needs no writes, such as a tombstone, yields no operations.
+type Transformer interface {
+	Transform(ctx context.Context, rec *Record) ([]Operation, error)
+}
+
+type TransformerFunc func(ctx context.Context, rec *Record) ([]Operation, error)
+
+func (f TransformerFunc) Transform(ctx context.Context, rec *Record) ([]Operation, error) {
+	return f(ctx, rec)
+}
+
+// Sink applies operations. Write may complete asynchronously; done is called
+// exactly once with the outcome, and failures worth retrying are
+// TransientErrors. Close flushes outstanding writes.
+type Sink interface {
+	Write(ctx context.Context, op Operation, done func(error)) error
+	Close(ctx context.Context) error
+}
+
+// Pipeline streams records from Source through Transformer into Sink. A
+// record is acknowledged only after all of its operations succeed or it has
+// been dead-lettered, so sources that commit acknowledged positions give
+// at-least-once delivery. Transient transformer and sink failures are
+// retried with Backoff before the record goes to DeadLetters.
+type Pipeline struct {
+	Name           string
+	Source         Source
+	Transformer    Transformer
+	Sink           Sink
+	DeadLetters    DeadLetterSink
+	Backoff        Backoff
+	CommitInterval time.Duration
+
+	inFlight sync.WaitGroup
+	stopping atomic.Bool
+}
+
+// Run processes records until ctx is cancelled or the source is exhausted,
+// then flushes the sink, commits and closes the source. When the source is
+// exhausted, Run first waits for every record to be acknowledged. When ctx is
+// cancelled it does not; records still being retried are left
+// unacknowledged for redelivery.
+func (p *Pipeline) Run(ctx context.Context) error {
+	lastCommit := time.Now()
+	for ctx.Err() == nil {
+		rec, err := p.Source.Read(ctx)
+		if err == io.EOF {
+			p.inFlight.Wait()
+			break
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("%s: error reading: %v", p.Name, err)
+		}
+		if rec != nil {
+			p.handle(ctx, rec)
+		}
+
+		if time.Since(lastCommit) >= p.CommitInterval {
+			p.commit()
+			lastCommit = time.Now()
+		}
+	}
+
+	p.stopping.Store(true)
+	if err := p.Sink.Close(context.Background()); err != nil {
+		log.Printf("%s: error flushing sink: %v", p.Name, err)
+	}
+	p.commit()
+	return p.Source.Close()
+}
+
+func (p *Pipeline) handle(ctx context.Context, rec *Record) {
+	p.inFlight.Add(1)
+	ack := func() {
+		rec.Ack()
+		p.inFlight.Done()
+	}
+
+	ops, err := p.transform(ctx, rec)
+	if err != nil && ctx.Err() != nil {
+		// Shutting down mid-retry: leave the record for redelivery.
+		return
+	}
+	if err != nil {
+		p.deadLetter(rec, StageTransform, err)
+		ack()
+		return
+	}
+	if len(ops) == 0 {
+		ack()
+		return
+	}
+	for i := range ops {
+		ops[i].Version = rec.Offset
+	}
+
+	// A record is dead-lettered once, however many of its operations fail.
+	pending := int32(len(ops))
+	var failed sync.Once
+	finish := func(err error) {
+		if err != nil {
+			failed.Do(func() { p.deadLetter(rec, StageIndex, err) })
+		}
+		if atomic.AddInt32(&pending, -1) == 0 {
+			ack()
+		}
+	}
+	for _, op := range ops {
+		p.write(ctx, rec, op, 1, finish)
+	}
+}
+
+// transform runs the transformer, retrying transient failures such as an
+// unavailable lookup. Retries block the pipeline, which holds back reading
+// until whatever the transformer depends on is back.
+func (p *Pipeline) transform(ctx context.Context, rec *Record) ([]Operation, error) {
+	for attempt := 1; ; attempt++ {
+		ops, err := p.Transformer.Transform(ctx, rec)
+		if err == nil || !IsTransient(err) || attempt >= p.Backoff.MaxAttempts {
+			return ops, err
+		}
+
+		delay := p.Backoff.Delay(attempt)
+		log.Printf("%s: retrying transform of %s[%d]@%d in %v after attempt %d failed: %v",
+			p.Name, rec.Topic, rec.Partition, rec.Offset, delay, attempt, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
+
+func (p *Pipeline) write(ctx context.Context, rec *Record, op Operation, attempt int, finish func(error)) {
+	err := p.Sink.Write(ctx, op, func(err error) {
+		if err != nil {
+			p.retry(ctx, rec, op, attempt, finish, err)
+			return
+		}
+		finish(nil)
+	})
+	if err != nil {
+		p.retry(ctx, rec, op, attempt, finish, &TransientError{Err: err})
+	}
+}
+
+func (p *Pipeline) retry(ctx context.Context, rec *Record, op Operation, attempt int, finish func(error), err error) {
+	if !IsTransient(err) || attempt >= p.Backoff.MaxAttempts {
+		finish(err)
+		return
+	}
+	if p.stopping.Load() {
+		return
+	}
+
+	delay := p.Backoff.Delay(attempt)
+	log.Printf("%s: retrying %s %s of %s[%d]@%d in %v after attempt %d failed: %v",
+		p.Name, op.Action, op.DocumentID, rec.Topic, rec.Partition, rec.Offset, delay, attempt, err)
+	// Not called inline: done may run on a sink worker that must not block
+	// on Write.
+	time.AfterFunc(delay, func() {
+		if p.stopping.Load() {
+			return
+		}
+		p.write(ctx, rec, op, attempt+1, finish)
+	})
+}
+
+func (p *Pipeline) commit() {
+	if err := p.Source.Commit(); err != nil {
+		log.Printf("%s: error committing: %v", p.Name, err)
+	}
+}
+
+// deadLetter stores a failed record so the pipeline can move past it. If the
+// DLQ itself is unavailable the record would be lost, so that is fatal.
+func (p *Pipeline) deadLetter(rec *Record, stage string, err error) {
+	dl := NewDeadLetter(rec, stage, err)
+	log.Printf("%s: dead-lettering %s[%d]@%d after %s error: %s", p.Name, dl.Topic, dl.Partition, dl.Offset, dl.Stage, dl.Error)
+	if err := p.DeadLetters.Send(dl); err != nil {
+		log.Fatalf("%s: error writing dead letter: %v", p.Name, err)
+	}
+}
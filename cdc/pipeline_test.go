@@ -0,0 +1,300 @@
+package cdc
+
+import (
+	"binge/es"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+)
+
+// testPipeline wires records through transformer into sink, dead-lettering
+// to a file, with retries short enough for tests.
+func testPipeline(t *testing.T, records []*Record, transformer Transformer, sink Sink) (*Pipeline, *MemorySource, string) {
+	t.Helper()
+	dlqPath := filepath.Join(t.TempDir(), "dlq.jsonl")
+	dlq, err := NewFileSink(dlqPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dlq.Close() })
+
+	source := NewMemorySource(records)
+	return &Pipeline{
+		Name:           "test",
+		Source:         source,
+		Transformer:    transformer,
+		Sink:           sink,
+		DeadLetters:    dlq,
+		Backoff:        Backoff{Initial: time.Millisecond, Max: time.Millisecond, MaxAttempts: 3},
+		CommitInterval: time.Hour,
+	}, source, dlqPath
+}
+
+// runPipeline starts p and returns a function that waits for it to finish.
+func runPipeline(t *testing.T, p *Pipeline) func() {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- p.Run(context.Background()) }()
+	return func() {
+		t.Helper()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("pipeline did not finish")
+		}
+	}
+}
+
+func readDeadLetters(t *testing.T, path string) []DeadLetter {
+	t.Helper()
+	letters, err := ReadDeadLetterFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return letters
+}
+
+func usersRecord(t *testing.T, offset int64, file string) *Record {
+	t.Helper()
+	value, _ := readEnvelope(t, file)
+	return &Record{Topic: "dbserver1.binge.users", Offset: offset, Key: []byte(`{"id":42}`), Value: value}
+}
+
+// heldSink hands each completion to the test instead of reporting it, so
+// the test controls when the sink's writes finish.
+type heldSink struct {
+	*MemorySink
+	held chan func()
+}
+
+func (s heldSink) Write(ctx context.Context, op Operation, done func(error)) error {
+	return s.MemorySink.Write(ctx, op, func(err error) {
+		s.held <- func() { done(err) }
+	})
+}
+
+// flakySink fails the first failures writes with a transient error.
+type flakySink struct {
+	*MemorySink
+	failures int
+
+	mu       sync.Mutex
+	attempts int
+}
+
+func (s *flakySink) Write(ctx context.Context, op Operation, done func(error)) error {
+	s.mu.Lock()
+	s.attempts++
+	fail := s.attempts <= s.failures
+	s.mu.Unlock()
+
+	if fail {
+		done(&TransientError{Err: errors.New("503 Service Unavailable")})
+		return nil
+	}
+	return s.MemorySink.Write(ctx, op, done)
+}
+
+func TestPipelineAcksOnlyAfterSinkSuccess(t *testing.T) {
+	sink := heldSink{MemorySink: NewMemorySink(), held: make(chan func(), 1)}
+	p, source, _ := testPipeline(t,
+		[]*Record{usersRecord(t, 7, "users_precise_nyc.json")},
+		UsersTransformer{Index: "users"}, sink)
+	wait := runPipeline(t, p)
+
+	var release func()
+	select {
+	case release = <-sink.held:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sink was not written to")
+	}
+	if acked := source.Acked(); len(acked) != 0 {
+		t.Fatalf("acked %v before the sink finished", acked)
+	}
+	release()
+	wait()
+
+	if acked := source.Acked(); !reflect.DeepEqual(acked, []int64{7}) {
+		t.Errorf("acked %v, want [7]", acked)
+	}
+	if _, ok := sink.Document("users", "42"); !ok {
+		t.Error("document 42 was not indexed")
+	}
+}
+
+func TestPipelineRetriesTransientSinkErrors(t *testing.T) {
+	sink := &flakySink{MemorySink: NewMemorySink(), failures: 2}
+	p, source, dlqPath := testPipeline(t,
+		[]*Record{usersRecord(t, 7, "users_precise_nyc.json")},
+		UsersTransformer{Index: "users"}, sink)
+	runPipeline(t, p)()
+
+	if sink.attempts != 3 {
+		t.Errorf("sink tried %d times, want 3", sink.attempts)
+	}
+	if _, ok := sink.Document("users", "42"); !ok {
+		t.Error("document 42 was not indexed")
+	}
+	if letters := readDeadLetters(t, dlqPath); len(letters) != 0 {
+		t.Errorf("got dead letters %+v", letters)
+	}
+	if acked := source.Acked(); !reflect.DeepEqual(acked, []int64{7}) {
+		t.Errorf("acked %v, want [7]", acked)
+	}
+}
+
+func TestPipelineDeadLettersAfterMaxAttempts(t *testing.T) {
+	sink := &flakySink{MemorySink: NewMemorySink(), failures: 100}
+	rec := usersRecord(t, 7, "users_precise_nyc.json")
+	p, source, dlqPath := testPipeline(t, []*Record{rec}, UsersTransformer{Index: "users"}, sink)
+	runPipeline(t, p)()
+
+	if sink.attempts != p.Backoff.MaxAttempts {
+		t.Errorf("sink tried %d times, want %d", sink.attempts, p.Backoff.MaxAttempts)
+	}
+	letters := readDeadLetters(t, dlqPath)
+	if len(letters) != 1 {
+		t.Fatalf("got %d dead letters, want 1", len(letters))
+	}
+	dl := letters[0]
+	if dl.Stage != StageIndex || dl.Offset != 7 || dl.Value != string(rec.Value) {
+		t.Errorf("dead letter = %+v", dl)
+	}
+	if acked := source.Acked(); !reflect.DeepEqual(acked, []int64{7}) {
+		t.Errorf("acked %v, want [7]", acked)
+	}
+}
+
+func TestPipelineDeadLettersTransformErrors(t *testing.T) {
+	sink := NewMemorySink()
+	p, source, dlqPath := testPipeline(t,
+		[]*Record{{Topic: "dbserver1.binge.users", Offset: 3, Value: []byte("{not json")}},
+		UsersTransformer{Index: "users"}, sink)
+	runPipeline(t, p)()
+
+	letters := readDeadLetters(t, dlqPath)
+	if len(letters) != 1 || letters[0].Stage != StageTransform {
+		t.Fatalf("dead letters = %+v, want one from the transform stage", letters)
+	}
+	if acked := source.Acked(); !reflect.DeepEqual(acked, []int64{3}) {
+		t.Errorf("acked %v, want [3]", acked)
+	}
+}
+
+func TestPipelineTombstoneYieldsNoOperations(t *testing.T) {
+	sink := &flakySink{MemorySink: NewMemorySink()}
+	p, source, dlqPath := testPipeline(t,
+		[]*Record{{Topic: "dbserver1.binge.users", Offset: 9, Key: []byte(`{"id":42}`)}},
+		UsersTransformer{Index: "users"}, sink)
+	runPipeline(t, p)()
+
+	if sink.attempts != 0 {
+		t.Errorf("tombstone caused %d writes", sink.attempts)
+	}
+	if letters := readDeadLetters(t, dlqPath); len(letters) != 0 {
+		t.Errorf("got dead letters %+v", letters)
+	}
+	if acked := source.Acked(); !reflect.DeepEqual(acked, []int64{9}) {
+		t.Errorf("acked %v, want [9]", acked)
+	}
+}
+
+func TestIndexFailure(t *testing.T) {
+	failure := func(status int, errType string) esutil.BulkIndexerResponseItem {
+		res := esutil.BulkIndexerResponseItem{Status: status}
+		res.Error.Type = errType
+		return res
+	}
+	tests := []struct {
+		name   string
+		action string
+		res    esutil.BulkIndexerResponseItem
+		err    error
+		want   string // "", "transient" or "permanent"
+	}{
+		{name: "request failed", action: "index", err: errors.New("connection refused"), want: "transient"},
+		{name: "stale version", action: "index", res: failure(409, "version_conflict_engine_exception")},
+		{name: "too many requests", action: "index", res: failure(429, "es_rejected_execution_exception"), want: "transient"},
+		{name: "server error", action: "index", res: failure(500, "exception"), want: "transient"},
+		{name: "unavailable", action: "index", res: failure(503, "unavailable_shards_exception"), want: "transient"},
+		{name: "bad document", action: "index", res: failure(400, "mapper_parsing_exception"), want: "permanent"},
+		// Deletes are written as tombstones, so a 404 can only mean the index
+		// itself is gone.
+		{name: "missing index", action: "index", res: failure(404, "index_not_found_exception"), want: "permanent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := indexFailure(esutil.BulkIndexerItem{Action: tt.action}, tt.res, tt.err)
+			var transient *TransientError
+			got := ""
+			switch {
+			case errors.As(err, &transient):
+				got = "transient"
+			case err != nil:
+				got = "permanent"
+			}
+			if got != tt.want {
+				t.Errorf("indexFailure = %v, want a %q failure", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipelineDropsStaleWrites(t *testing.T) {
+	sink := NewMemorySink()
+	// Each record's value is the document body, so a redelivered older
+	// record shows up as its body winning.
+	transformer := TransformerFunc(func(ctx context.Context, rec *Record) ([]Operation, error) {
+		return []Operation{{Action: "index", Index: "users", DocumentID: "42", Body: rec.Value}}, nil
+	})
+	p, _, _ := testPipeline(t, []*Record{
+		{Offset: 10, Value: []byte(`{"gender":"woman"}`)},
+		{Offset: 5, Value: []byte(`{"gender":"man"}`)},
+	}, transformer, sink)
+	runPipeline(t, p)()
+
+	body, ok := sink.Document("users", "42")
+	if !ok || string(body) != `{"gender":"woman"}` {
+		t.Errorf("document = %s, want the write at offset 10", body)
+	}
+}
+
+func TestPipelineSwipesWithLocations(t *testing.T) {
+	sink := NewMemorySink()
+	users := MemoryLocationLookup{"42": es.GeoPoint{Lat: 40.712776, Lon: -74.005974}}
+	swipe := []byte(`{"payload":{"op":"c","after":{"id":3,"user_swiped":42,"user_swiped_on":7,"swipe_type":"right","created_at":"2026-10-18T10:15:30Z"}}}`)
+	p, _, _ := testPipeline(t,
+		[]*Record{{Topic: "dbserver1.binge.swipes", Offset: 1, Value: swipe}},
+		SwipesTransformer{Index: "swipes", Users: users}, sink)
+	runPipeline(t, p)()
+
+	body, ok := sink.Document("swipes", "3")
+	if !ok {
+		t.Fatal("swipe was not indexed")
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"lat": 40.712776, "lon": -74.005974}
+	if !reflect.DeepEqual(doc["swiper_location"], want) {
+		t.Errorf("swiper_location = %v, want %v", doc["swiper_location"], want)
+	}
+	if _, ok := doc["swiped_on_location"]; ok {
+		t.Error("swiped_on_location set for a user missing from the lookup")
+	}
+	if doc["direction"] != "right" {
+		t.Errorf("direction = %v, want right", doc["direction"])
+	}
+}
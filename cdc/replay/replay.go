@@ -0,0 +1,103 @@
+package main
+
+import (
+	"binge/cdc"
+	"binge/config"
+	"binge/es"
+	"binge/lifecycle"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// replay re-processes dead letters of one table's CDC consumer, typically
+// after the bug or outage that put them there has been fixed. Letters that
+// fail again, including letters from another table's topic, are written to
+// the -failed file. Letters keep their original offsets as versions, so one
+// older than a later change to its row, deletes included, is dropped.
+func main() {
+	table := flag.String("table", "users", "table whose dead letters to replay: users, swipes or matches")
+	file := flag.String("file", "", "replay dead letters from this file")
+	topic := flag.String("topic", "", "replay dead letters from this Kafka topic when -file is not set (default: the table's DLQ topic)")
+	failed := flag.String("failed", "dlq-replay-failed.jsonl", "file to write dead letters that fail again to")
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	tableTopic := cfg.CDC.Topic(*table)
+	if *topic == "" {
+		*topic = tableTopic + ".dlq"
+	}
+
+	ctx, stop := lifecycle.SignalContext(context.Background())
+	defer stop()
+
+	consumer, err := cdc.TableConsumer(cfg, *table)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cl, err := es.NewElasticsearchClient(cfg.Elasticsearch.ClientConfig)
+	if err != nil {
+		log.Fatalf("Error setting up Elasticsearch: %v", err)
+	}
+	// Letters go to the index the table's consumer writes to.
+	transformer := consumer.NewTransformer(cl)
+	bi, err := es.NewBulkIndexer(cl, consumer.Index)
+	if err != nil {
+		log.Fatalf("Error setting up Elasticsearch: %v", err)
+	}
+
+	sink, err := cdc.NewFileSink(*failed)
+	if err != nil {
+		log.Fatalf("Error opening %s: %v", *failed, err)
+	}
+	defer sink.Close()
+
+	var source cdc.Source
+	if *file != "" {
+		letters, err := cdc.ReadDeadLetterFile(*file)
+		if err != nil {
+			log.Fatalf("Error reading %s: %v", *file, err)
+		}
+		records := make([]*cdc.Record, len(letters))
+		for i, dl := range letters {
+			records[i] = dl.Record()
+		}
+		source = cdc.NewMemorySource(records)
+	} else {
+		// Progress is committed under its own consumer group, so a second
+		// run picks up where this one stopped.
+		kafkaSource, err := cdc.NewKafkaSource(cdc.KafkaSourceConfig{
+			BootstrapServers: cfg.Kafka.BootstrapServers(),
+			GroupID:          "binge-" + *table + "-dlq-replay",
+			Topics:           []string{*topic},
+			IdleTimeout:      10 * time.Second,
+		})
+		if err != nil {
+			log.Fatalf("Error consuming %s: %v", *topic, err)
+		}
+		source = cdc.DeadLetterSource{Source: kafkaSource}
+	}
+
+	pipeline := &cdc.Pipeline{
+		Name:   *table + "-replay",
+		Source: source,
+		Transformer: cdc.TransformerFunc(func(ctx context.Context, rec *cdc.Record) ([]cdc.Operation, error) {
+			if rec.Topic != tableTopic {
+				return nil, fmt.Errorf("dead letter from %s, not %s", rec.Topic, tableTopic)
+			}
+			return transformer.Transform(ctx, rec)
+		}),
+		Sink:           cdc.NewESSink(bi),
+		DeadLetters:    sink,
+		Backoff:        cdc.DefaultBackoff(),
+		CommitInterval: cfg.CDC.CommitInterval,
+	}
+	if err := pipeline.Run(ctx); err != nil {
+		log.Fatalf("Error replaying dead letters: %v", err)
+	}
+	log.Printf("Replay finished; letters that failed again are in %s", *failed)
+}
@@ -0,0 +1,53 @@
+package cdc
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Backoff is an exponential retry schedule with full jitter.
+type Backoff struct {
+	Initial     time.Duration
+	Max         time.Duration
+	MaxAttempts int
+}
+
+func DefaultBackoff() Backoff {
+	return Backoff{
+		Initial:     500 * time.Millisecond,
+		Max:         30 * time.Second,
+		MaxAttempts: 5,
+	}
+}
+
+// Delay returns how long to wait before retry number attempt, counting
+// from 1.
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := b.Initial
+	for i := 1; i < attempt && d < b.Max; i++ {
+		d *= 2
+	}
+	if d > b.Max {
+		d = b.Max
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// TransientError marks a failure that may succeed if tried again.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+func IsTransient(err error) bool {
+	var transient *TransientError
+	return errors.As(err, &transient)
+}
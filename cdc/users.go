@@ -0,0 +1,42 @@
+package cdc
+
+import (
+	"context"
+	"fmt"
+)
+
+// UsersTransformer maps users change events to operations on the user's
+// document, whose ID is the MySQL user ID: creates, updates and snapshot
+// reads replace the document, deletes remove it.
+type UsersTransformer struct {
+	Index string
+}
+
+func (t UsersTransformer) Transform(ctx context.Context, rec *Record) ([]Operation, error) {
+	event, err := ParseChangeEvent(rec.Value)
+	if err != nil || event == nil {
+		return nil, err
+	}
+
+	if event.Op == OpDelete {
+		id, err := RecordID(event.Before)
+		if err != nil {
+			return nil, err
+		}
+		return []Operation{{Action: "delete", Index: t.Index, DocumentID: id}}, nil
+	}
+
+	id, err := RecordID(event.After)
+	if err != nil {
+		return nil, err
+	}
+	scales, err := DecimalScales(rec.Value, "after")
+	if err != nil {
+		return nil, fmt.Errorf("error reading message schema: %w", err)
+	}
+	esData, err := TransformCreateOperationForES(event.After, scales)
+	if err != nil {
+		return nil, err
+	}
+	return []Operation{{Action: "index", Index: t.Index, DocumentID: id, Body: esData}}, nil
+}
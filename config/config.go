@@ -0,0 +1,321 @@
+package config
+
+import (
+	"binge/es"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the settings of every binge binary. Each binary reads only
+// the sections it needs.
+type Config struct {
+	HTTP          HTTPConfig          `yaml:"http"`
+	MySQL         MySQLConfig         `yaml:"mysql"`
+	Redis         RedisConfig         `yaml:"redis"`
+	Kafka         KafkaConfig         `yaml:"kafka"`
+	Elasticsearch ElasticsearchConfig `yaml:"elasticsearch"`
+	BloomFilter   BloomFilterConfig   `yaml:"bloom_filter"`
+	CDC           CDCConfig           `yaml:"cdc"`
+	Ranking       es.RankingConfig    `yaml:"ranking"`
+	AdminToken    string              `yaml:"admin_token"`
+}
+
+type HTTPConfig struct {
+	Addr string `yaml:"addr"`
+	// ShutdownTimeout bounds how long in-flight requests get to finish once
+	// the server is asked to stop.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type MySQLConfig struct {
+	Addr     string `yaml:"addr"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Database string `yaml:"database"`
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+type KafkaConfig struct {
+	Brokers []string `yaml:"brokers"`
+	// ResizeTopic receives bloom filter resize events.
+	ResizeTopic string `yaml:"resize_topic"`
+}
+
+type ElasticsearchConfig struct {
+	es.ClientConfig `yaml:",inline"`
+	// Index is the users index the feed searches.
+	Index string `yaml:"index"`
+	// SwipesIndex and MatchesIndex are the analytics indices the swipes and
+	// matches CDC consumers write to.
+	SwipesIndex  string `yaml:"swipes_index"`
+	MatchesIndex string `yaml:"matches_index"`
+}
+
+// defaultElasticsearchAddress is used when neither a Cloud ID nor addresses
+// are configured: a local single-node cluster with security off.
+const defaultElasticsearchAddress = "http://localhost:9200"
+
+type BloomFilterConfig struct {
+	ExpectedItems uint    `yaml:"expected_items"`
+	FPRate        float64 `yaml:"fp_rate"`
+}
+
+type CDCConfig struct {
+	// TopicPrefix is Debezium's topic prefix for the binge database; each
+	// table's changes are on <prefix>.<table>.
+	TopicPrefix    string        `yaml:"topic_prefix"`
+	CommitInterval time.Duration `yaml:"commit_interval"`
+	// DLQFile, if set, makes consumers write dead letters to this file
+	// instead of the table topic's .dlq topic.
+	DLQFile string `yaml:"dlq_file"`
+}
+
+func Default() Config {
+	return Config{
+		HTTP: HTTPConfig{
+			Addr:            ":3000",
+			ShutdownTimeout: 30 * time.Second,
+		},
+		MySQL: MySQLConfig{
+			Addr: "localhost:3306",
+		},
+		Redis: RedisConfig{
+			Addr: "localhost:6379",
+		},
+		Kafka: KafkaConfig{
+			Brokers:     []string{"localhost:9092"},
+			ResizeTopic: "bloom-filter-resizes",
+		},
+		Elasticsearch: ElasticsearchConfig{
+			Index:        "users",
+			SwipesIndex:  "swipes",
+			MatchesIndex: "matches",
+		},
+		BloomFilter: BloomFilterConfig{
+			ExpectedItems: 10000,
+			FPRate:        0.01,
+		},
+		CDC: CDCConfig{
+			TopicPrefix:    "dbserver1.binge",
+			CommitInterval: 5 * time.Second,
+		},
+		Ranking: es.DefaultRankingConfig(),
+	}
+}
+
+// Topic returns the Debezium topic carrying a table's changes.
+func (c CDCConfig) Topic(table string) string {
+	return c.TopicPrefix + "." + table
+}
+
+// BootstrapServers returns the brokers in the form librdkafka expects.
+func (c KafkaConfig) BootstrapServers() string {
+	return strings.Join(c.Brokers, ",")
+}
+
+// Load builds the config from, in increasing order of precedence, the
+// defaults, the YAML file named by -config or BINGE_CONFIG, environment
+// variables and flags. It registers its flags on fs and parses args, so a
+// binary defines its own flags on fs before calling it.
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	path := fs.String("config", os.Getenv("BINGE_CONFIG"), "path to a YAML config file")
+	flags := registerFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+	cfg.loadEnv()
+	flags.apply(fs, &cfg)
+	if cfg.Elasticsearch.CloudID == "" && len(cfg.Elasticsearch.Addresses) == 0 {
+		cfg.Elasticsearch.Addresses = []string{defaultElasticsearchAddress}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return &cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// envVars maps environment variables to the settings they override. The
+// unprefixed names predate the config package and are kept for existing
+// deployments.
+func (c *Config) envVars() map[string]*string {
+	return map[string]*string{
+		"BINGE_HTTP_ADDR":           &c.HTTP.Addr,
+		"BINGE_MYSQL_ADDR":          &c.MySQL.Addr,
+		"SQL_USER":                  &c.MySQL.User,
+		"SQL_PASS":                  &c.MySQL.Password,
+		"GLOBAL_DB":                 &c.MySQL.Database,
+		"BINGE_REDIS_ADDR":          &c.Redis.Addr,
+		"BINGE_REDIS_PASS":          &c.Redis.Password,
+		"CLOUD_ID_ES":               &c.Elasticsearch.CloudID,
+		"API_KEY_ES":                &c.Elasticsearch.APIKey,
+		"BINGE_ES_USERNAME":         &c.Elasticsearch.Username,
+		"BINGE_ES_PASSWORD":         &c.Elasticsearch.Password,
+		"BINGE_ES_CA_CERT":          &c.Elasticsearch.CACertPath,
+		"BINGE_ES_CERT_FINGERPRINT": &c.Elasticsearch.CertificateFingerprint,
+		"ADMIN_TOKEN":               &c.AdminToken,
+		"BINGE_CDC_DLQ_FILE":        &c.CDC.DLQFile,
+	}
+}
+
+func (c *Config) loadEnv() {
+	for name, setting := range c.envVars() {
+		if v, ok := os.LookupEnv(name); ok {
+			*setting = v
+		}
+	}
+	if v, ok := os.LookupEnv("BINGE_KAFKA_BROKERS"); ok {
+		c.Kafka.Brokers = splitList(v)
+	}
+	if v, ok := os.LookupEnv("BINGE_ES_ADDRESSES"); ok {
+		c.Elasticsearch.Addresses = splitList(v)
+	}
+}
+
+// flagValues holds the flags Load registers. Only flags given on the
+// command line override the config, so that their defaults do not clobber
+// the file and environment.
+type flagValues struct {
+	httpAddr     *string
+	mysqlAddr    *string
+	redisAddr    *string
+	kafkaBrokers *string
+	esAddresses  *string
+	esCloudID    *string
+	esCACert     *string
+	esIndex      *string
+	dlqFile      *string
+}
+
+func registerFlags(fs *flag.FlagSet) *flagValues {
+	return &flagValues{
+		httpAddr:     fs.String("http-addr", "", "address the API server listens on"),
+		mysqlAddr:    fs.String("mysql-addr", "", "MySQL host:port"),
+		redisAddr:    fs.String("redis-addr", "", "Redis host:port"),
+		kafkaBrokers: fs.String("kafka-brokers", "", "comma-separated Kafka brokers"),
+		esAddresses:  fs.String("es-addresses", "", "comma-separated Elasticsearch URLs"),
+		esCloudID:    fs.String("es-cloud-id", "", "Elasticsearch Cloud ID"),
+		esCACert:     fs.String("es-ca-cert", "", "PEM file of the CA that signed Elasticsearch's certificate"),
+		esIndex:      fs.String("es-index", "", "Elasticsearch users index"),
+		dlqFile:      fs.String("dlq-file", "", "write CDC dead letters to this file instead of the Kafka DLQ topic"),
+	}
+}
+
+func (f *flagValues) apply(fs *flag.FlagSet, c *Config) {
+	settings := map[string]struct {
+		value  *string
+		target *string
+	}{
+		"http-addr":   {f.httpAddr, &c.HTTP.Addr},
+		"mysql-addr":  {f.mysqlAddr, &c.MySQL.Addr},
+		"redis-addr":  {f.redisAddr, &c.Redis.Addr},
+		"es-cloud-id": {f.esCloudID, &c.Elasticsearch.CloudID},
+		"es-ca-cert":  {f.esCACert, &c.Elasticsearch.CACertPath},
+		"es-index":    {f.esIndex, &c.Elasticsearch.Index},
+		"dlq-file":    {f.dlqFile, &c.CDC.DLQFile},
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		if s, ok := settings[fl.Name]; ok {
+			*s.target = *s.value
+		}
+		switch fl.Name {
+		case "kafka-brokers":
+			c.Kafka.Brokers = splitList(*f.kafkaBrokers)
+		case "es-addresses":
+			c.Elasticsearch.Addresses = splitList(*f.esAddresses)
+		}
+	})
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Validate checks that settings are well formed. It does not require
+// credentials, which not every binary needs.
+func (c *Config) Validate() error {
+	addrs := map[string]string{
+		"http.addr":  c.HTTP.Addr,
+		"mysql.addr": c.MySQL.Addr,
+		"redis.addr": c.Redis.Addr,
+	}
+	for name, addr := range addrs {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if len(c.Kafka.Brokers) == 0 {
+		return fmt.Errorf("kafka.brokers must not be empty")
+	}
+	for _, broker := range c.Kafka.Brokers {
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			return fmt.Errorf("kafka.brokers: %w", err)
+		}
+	}
+	if c.Redis.DB < 0 {
+		return fmt.Errorf("redis.db must not be negative, got %d", c.Redis.DB)
+	}
+	if err := c.Elasticsearch.Validate(); err != nil {
+		return fmt.Errorf("elasticsearch: %w", err)
+	}
+	if c.Elasticsearch.Index == "" {
+		return fmt.Errorf("elasticsearch.index must be set")
+	}
+	if c.Elasticsearch.SwipesIndex == "" || c.Elasticsearch.MatchesIndex == "" {
+		return fmt.Errorf("elasticsearch.swipes_index and elasticsearch.matches_index must be set")
+	}
+	if err := c.Ranking.Validate(); err != nil {
+		return fmt.Errorf("ranking: %w", err)
+	}
+	if c.BloomFilter.ExpectedItems == 0 {
+		return fmt.Errorf("bloom_filter.expected_items must be positive")
+	}
+	if c.BloomFilter.FPRate <= 0 || c.BloomFilter.FPRate >= 1 {
+		return fmt.Errorf("bloom_filter.fp_rate must be in (0, 1), got %v", c.BloomFilter.FPRate)
+	}
+	if c.HTTP.ShutdownTimeout <= 0 {
+		return fmt.Errorf("http.shutdown_timeout must be positive")
+	}
+	if c.CDC.CommitInterval <= 0 {
+		return fmt.Errorf("cdc.commit_interval must be positive")
+	}
+	if c.CDC.TopicPrefix == "" {
+		return fmt.Errorf("cdc.topic_prefix must be set")
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "binge.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+http:
+  addr: ":4000"
+mysql:
+  addr: file-mysql:3306
+redis:
+  addr: file-redis:6379
+elasticsearch:
+  index: file-users
+  swipes_index: file-swipes
+`)
+	t.Setenv("BINGE_CONFIG", path)
+	t.Setenv("BINGE_MYSQL_ADDR", "env-mysql:3306")
+	t.Setenv("BINGE_REDIS_ADDR", "env-redis:6379")
+	t.Setenv("BINGE_KAFKA_BROKERS", "env-kafka1:9092, env-kafka2:9092")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, err := Load(fs, []string{"-redis-addr", "flag-redis:6379", "-es-index", "flag-users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaults := Default()
+	tests := []struct {
+		setting string
+		got     interface{}
+		want    interface{}
+	}{
+		{"matches index (default)", cfg.Elasticsearch.MatchesIndex, defaults.Elasticsearch.MatchesIndex},
+		{"resize topic (default)", cfg.Kafka.ResizeTopic, defaults.Kafka.ResizeTopic},
+		{"http addr (file)", cfg.HTTP.Addr, ":4000"},
+		{"swipes index (file)", cfg.Elasticsearch.SwipesIndex, "file-swipes"},
+		{"mysql addr (env over file)", cfg.MySQL.Addr, "env-mysql:3306"},
+		{"kafka brokers (env over default)", cfg.Kafka.Brokers, []string{"env-kafka1:9092", "env-kafka2:9092"}},
+		{"redis addr (flag over env)", cfg.Redis.Addr, "flag-redis:6379"},
+		{"users index (flag over file)", cfg.Elasticsearch.Index, "flag-users"},
+		{"es addresses (fallback)", cfg.Elasticsearch.Addresses, []string{defaultElasticsearchAddress}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.setting, tt.got, tt.want)
+		}
+	}
+}
+
+// TestLoadUnsetFlagsKeepConfig checks that flags left at their empty
+// defaults do not clear what the file and environment set.
+func TestLoadUnsetFlagsKeepConfig(t *testing.T) {
+	path := writeConfigFile(t, `
+http:
+  addr: ":4000"
+cdc:
+  dlq_file: file-dlq.jsonl
+`)
+	t.Setenv("BINGE_CONFIG", "")
+	t.Setenv("BINGE_MYSQL_ADDR", "env-mysql:3306")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, err := Load(fs, []string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.HTTP.Addr != ":4000" {
+		t.Errorf("http addr = %q, want the file's", cfg.HTTP.Addr)
+	}
+	if cfg.CDC.DLQFile != "file-dlq.jsonl" {
+		t.Errorf("dlq file = %q, want the file's", cfg.CDC.DLQFile)
+	}
+	if cfg.MySQL.Addr != "env-mysql:3306" {
+		t.Errorf("mysql addr = %q, want the environment's", cfg.MySQL.Addr)
+	}
+	if want := Default().Kafka.Brokers; !reflect.DeepEqual(cfg.Kafka.Brokers, want) {
+		t.Errorf("kafka brokers = %v, want the default %v", cfg.Kafka.Brokers, want)
+	}
+
+	// An explicitly given flag applies even when it matches a flag default.
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, err = Load(fs, []string{"-config", path, "-dlq-file", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CDC.DLQFile != "" {
+		t.Errorf("dlq file = %q, want it cleared by the flag", cfg.CDC.DLQFile)
+	}
+}
+
+func TestLoadRejectsInvalidConfig(t *testing.T) {
+	t.Setenv("BINGE_CONFIG", "")
+	tests := map[string][]string{
+		"bad address":     {"-redis-addr", "localhost"},
+		"empty index":     {"-es-index", ""},
+		"unknown flag":    {"-no-such-flag"},
+		"missing file":    {"-config", filepath.Join(t.TempDir(), "missing.yaml")},
+		"cloud and addrs": {"-es-cloud-id", "deployment:abc", "-es-addresses", "http://localhost:9200"},
+	}
+	for name, args := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		if _, err := Load(fs, args); err == nil {
+			t.Errorf("%s: Load(%q) succeeded", name, args)
+		}
+	}
+}
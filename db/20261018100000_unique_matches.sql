@@ -0,0 +1,40 @@
+-- +goose Up
+-- Matches used to be stored in whichever order the users were passed, so the
+-- same pair can exist as (a, b), as (b, a), or several times. Keep the oldest
+-- row of each pair, then store every pair in ascending order, before the
+-- unique key can be added.
+-- +goose StatementBegin
+DELETE m FROM matches m
+JOIN matches keep
+  ON LEAST(keep.user_id_1, keep.user_id_2) = LEAST(m.user_id_1, m.user_id_2)
+  AND GREATEST(keep.user_id_1, keep.user_id_2) = GREATEST(m.user_id_1, m.user_id_2)
+  AND keep.id < m.id;
+-- +goose StatementEnd
+
+-- MySQL evaluates single-table SET assignments left to right, so the swap
+-- reads the original values from a copy.
+-- +goose StatementBegin
+CREATE TEMPORARY TABLE match_pairs AS
+SELECT id, LEAST(user_id_1, user_id_2) AS lo, GREATEST(user_id_1, user_id_2) AS hi
+FROM matches
+WHERE user_id_1 > user_id_2;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE matches m
+JOIN match_pairs p ON p.id = m.id
+SET m.user_id_1 = p.lo, m.user_id_2 = p.hi;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TEMPORARY TABLE match_pairs;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE matches ADD UNIQUE KEY uniq_match_pair (user_id_1, user_id_2);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE matches DROP INDEX uniq_match_pair;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+  ADD COLUMN birthdate DATE,
+  ADD COLUMN gender ENUM('man', 'woman', 'nonbinary'),
+  ADD COLUMN interested_in SET('man', 'woman', 'nonbinary') NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+  DROP COLUMN interested_in,
+  DROP COLUMN gender,
+  DROP COLUMN birthdate;
+-- +goose StatementEnd
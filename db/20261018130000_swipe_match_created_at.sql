@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE swipes ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE matches ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE swipes DROP COLUMN created_at;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE matches DROP COLUMN created_at;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Passwords live outside users so that the users CDC stream, its dead
+-- letters and its consumers never see the hashes.
+-- +goose StatementBegin
+CREATE TABLE user_credentials (
+  user_id BIGINT NOT NULL PRIMARY KEY,
+  password_hash VARCHAR(60) NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE user_credentials;
+-- +goose StatementEnd
@@ -14,8 +14,8 @@ type DB struct {
 	migr *migr.Queries
 }
 
-func NewDB(sqlUser string, sqlPass string, globalDB string) (*DB, error) {
-	dbConnURL := fmt.Sprintf("%s:%s@tcp(localhost:3306)/%s?parseTime=true", sqlUser, sqlPass, globalDB)
+func NewDB(sqlUser string, sqlPass string, addr string, globalDB string) (*DB, error) {
+	dbConnURL := fmt.Sprintf("%s:%s@tcp(%s)/%s?parseTime=true", sqlUser, sqlPass, addr, globalDB)
 	db, err := sql.Open("mysql", dbConnURL)
 	if err != nil {
 		return nil, err
@@ -31,14 +31,92 @@ func NewDB(sqlUser string, sqlPass string, globalDB string) (*DB, error) {
 	return dbType, nil
 }
 
-func (d *DB) InsertUser(ctx context.Context, params migr.InsertUserParams) error {
+func (d *DB) GetUser(ctx context.Context, id int64) (migr.User, error) {
+	return d.migr.GetUser(ctx, id)
+}
+
+func (d *DB) InsertUser(ctx context.Context, params migr.InsertUserParams) (int64, error) {
 	return d.migr.InsertUser(ctx, params)
 }
 
+// InsertUserWithPassword creates a user along with their password hash, so
+// that a failed signup leaves no user behind that cannot log in.
+func (d *DB) InsertUserWithPassword(ctx context.Context, params migr.InsertUserParams, passwordHash string) (int64, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	q := d.migr.WithTx(tx)
+	userId, err := q.InsertUser(ctx, params)
+	if err != nil {
+		return 0, err
+	}
+	err = q.SetPasswordHash(ctx, migr.SetPasswordHashParams{UserID: userId, PasswordHash: passwordHash})
+	if err != nil {
+		return 0, err
+	}
+	return userId, tx.Commit()
+}
+
+// GetPasswordHash returns sql.ErrNoRows for users who never set a password,
+// such as those who signed up before passwords existed.
+func (d *DB) GetPasswordHash(ctx context.Context, userID int64) (string, error) {
+	return d.migr.GetPasswordHash(ctx, userID)
+}
+
+func (d *DB) SetPasswordHash(ctx context.Context, params migr.SetPasswordHashParams) error {
+	return d.migr.SetPasswordHash(ctx, params)
+}
+
 func (d *DB) InsertSwipe(ctx context.Context, params migr.InsertSwipeParams) error {
 	return d.migr.InsertSwipe(ctx, params)
 }
 
-func (d *DB) InsertMatch(ctx context.Context, params migr.InsertMatchParams) error {
+// HasMutualRightSwipes reports whether both users swiped right on each other.
+func (d *DB) HasMutualRightSwipes(ctx context.Context, params migr.HasMutualRightSwipesParams) (bool, error) {
+	return d.migr.HasMutualRightSwipes(ctx, params)
+}
+
+// InsertMatch stores a match and returns its ID. Inserting a pair that
+// already exists returns the existing row's ID instead of failing.
+func (d *DB) InsertMatch(ctx context.Context, params migr.InsertMatchParams) (int64, error) {
 	return d.migr.InsertMatch(ctx, params)
 }
+
+// ListExcludedUserIDs returns the Limit users the user most recently swiped
+// on or matched with, most recent first.
+func (d *DB) ListExcludedUserIDs(ctx context.Context, params migr.ListExcludedUserIDsParams) ([]int64, error) {
+	return d.migr.ListExcludedUserIDs(ctx, params)
+}
+
+func (d *DB) ListSwipedOnByUser(ctx context.Context, params migr.ListSwipedOnByUserParams) ([]migr.ListSwipedOnByUserRow, error) {
+	return d.migr.ListSwipedOnByUser(ctx, params)
+}
+
+func (d *DB) ListUserIDs(ctx context.Context, params migr.ListUserIDsParams) ([]int64, error) {
+	return d.migr.ListUserIDs(ctx, params)
+}
+
+// ListIncomingSwipeStats aggregates, for every user who has been swiped on,
+// the right swipes they received and all swipes they received, each swipe
+// weighted by how selective its swiper is (1 - the swiper's right-swipe
+// ratio, but never below minWeight).
+func (d *DB) ListIncomingSwipeStats(ctx context.Context, minWeight float64) ([]migr.ListIncomingSwipeStatsRow, error) {
+	return d.migr.ListIncomingSwipeStats(ctx, minWeight)
+}
+
+// UpdateDesirability stores a user's desirability score without bumping
+// updated_at, which feed ranking treats as activity.
+func (d *DB) UpdateDesirability(ctx context.Context, params migr.UpdateDesirabilityParams) error {
+	return d.migr.UpdateDesirability(ctx, params)
+}
+
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+func (d *DB) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
@@ -8,6 +8,7 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
+	"time"
 )
 
 type SwipesSwipeType string
@@ -52,10 +53,54 @@ func (ns NullSwipesSwipeType) Value() (driver.Value, error) {
 	return string(ns.SwipesSwipeType), nil
 }
 
+type UsersGender string
+
+const (
+	UsersGenderMan       UsersGender = "man"
+	UsersGenderWoman     UsersGender = "woman"
+	UsersGenderNonbinary UsersGender = "nonbinary"
+)
+
+func (e *UsersGender) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = UsersGender(s)
+	case string:
+		*e = UsersGender(s)
+	default:
+		return fmt.Errorf("unsupported scan type for UsersGender: %T", src)
+	}
+	return nil
+}
+
+type NullUsersGender struct {
+	UsersGender UsersGender
+	Valid       bool // Valid is true if UsersGender is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullUsersGender) Scan(value interface{}) error {
+	if value == nil {
+		ns.UsersGender, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.UsersGender.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullUsersGender) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.UsersGender), nil
+}
+
 type Match struct {
-	ID      int64
-	UserID1 int64
-	UserID2 int64
+	ID        int64
+	UserID1   int64
+	UserID2   int64
+	CreatedAt time.Time
 }
 
 type Swipe struct {
@@ -63,14 +108,24 @@ type Swipe struct {
 	UserSwiped   int64
 	UserSwipedOn int64
 	SwipeType    SwipesSwipeType
+	CreatedAt    time.Time
 }
 
 type User struct {
-	ID        int64
-	FirstName string
-	LastName  string
-	Bio       string
-	Latitude  string
-	Longitude string
-	UpdatedAt sql.NullTime
+	ID           int64
+	FirstName    string
+	LastName     string
+	Bio          string
+	Latitude     string
+	Longitude    string
+	UpdatedAt    sql.NullTime
+	Birthdate    sql.NullTime
+	Gender       NullUsersGender
+	InterestedIn string
+	Desirability float64
+}
+
+type UserCredential struct {
+	UserID       int64
+	PasswordHash string
 }
@@ -7,16 +7,29 @@ package migr
 
 import (
 	"context"
+	"database/sql"
 )
 
+const getPasswordHash = `-- name: GetPasswordHash :one
+SELECT password_hash FROM user_credentials
+WHERE user_id = ?
+`
+
+func (q *Queries) GetPasswordHash(ctx context.Context, userID int64) (string, error) {
+	row := q.db.QueryRowContext(ctx, getPasswordHash, userID)
+	var password_hash string
+	err := row.Scan(&password_hash)
+	return password_hash, err
+}
+
 const getUser = `-- name: GetUser :one
-SELECT id, first_name, last_name, bio, latitude, longitude, updated_at FROM users
-WHERE id = $1
+SELECT id, first_name, last_name, bio, latitude, longitude, updated_at, birthdate, gender, interested_in, desirability FROM users
+WHERE id = ?
 LIMIT 1
 `
 
-func (q *Queries) GetUser(ctx context.Context) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUser)
+func (q *Queries) GetUser(ctx context.Context, id int64) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUser, id)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -26,13 +39,42 @@ func (q *Queries) GetUser(ctx context.Context) (User, error) {
 		&i.Latitude,
 		&i.Longitude,
 		&i.UpdatedAt,
+		&i.Birthdate,
+		&i.Gender,
+		&i.InterestedIn,
+		&i.Desirability,
 	)
 	return i, err
 }
 
-const insertMatch = `-- name: InsertMatch :exec
+const hasMutualRightSwipes = `-- name: HasMutualRightSwipes :one
+SELECT COUNT(DISTINCT user_swiped) = 2 AS mutual FROM swipes
+WHERE swipe_type = 'right'
+  AND ((user_swiped = ? AND user_swiped_on = ?)
+    OR (user_swiped = ? AND user_swiped_on = ?))
+`
+
+type HasMutualRightSwipesParams struct {
+	UserA int64
+	UserB int64
+}
+
+func (q *Queries) HasMutualRightSwipes(ctx context.Context, arg HasMutualRightSwipesParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, hasMutualRightSwipes,
+		arg.UserA,
+		arg.UserB,
+		arg.UserB,
+		arg.UserA,
+	)
+	var mutual bool
+	err := row.Scan(&mutual)
+	return mutual, err
+}
+
+const insertMatch = `-- name: InsertMatch :execlastid
 INSERT INTO matches (user_id_1, user_id_2)
 VALUES (?, ?)
+ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)
 `
 
 type InsertMatchParams struct {
@@ -40,9 +82,12 @@ type InsertMatchParams struct {
 	UserID2 int64
 }
 
-func (q *Queries) InsertMatch(ctx context.Context, arg InsertMatchParams) error {
-	_, err := q.db.ExecContext(ctx, insertMatch, arg.UserID1, arg.UserID2)
-	return err
+func (q *Queries) InsertMatch(ctx context.Context, arg InsertMatchParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, insertMatch, arg.UserID1, arg.UserID2)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
 }
 
 const insertSwipe = `-- name: InsertSwipe :exec
@@ -61,26 +106,238 @@ func (q *Queries) InsertSwipe(ctx context.Context, arg InsertSwipeParams) error
 	return err
 }
 
-const insertUser = `-- name: InsertUser :exec
-INSERT INTO users (first_name, last_name, bio, latitude, longitude)
-VALUES (?, ?, ?, ?, ?)
+const insertUser = `-- name: InsertUser :execlastid
+INSERT INTO users (first_name, last_name, bio, latitude, longitude, birthdate, gender, interested_in)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 `
 
 type InsertUserParams struct {
-	FirstName string
-	LastName  string
-	Bio       string
-	Latitude  string
-	Longitude string
+	FirstName    string
+	LastName     string
+	Bio          string
+	Latitude     string
+	Longitude    string
+	Birthdate    sql.NullTime
+	Gender       NullUsersGender
+	InterestedIn string
 }
 
-func (q *Queries) InsertUser(ctx context.Context, arg InsertUserParams) error {
-	_, err := q.db.ExecContext(ctx, insertUser,
+func (q *Queries) InsertUser(ctx context.Context, arg InsertUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, insertUser,
 		arg.FirstName,
 		arg.LastName,
 		arg.Bio,
 		arg.Latitude,
 		arg.Longitude,
+		arg.Birthdate,
+		arg.Gender,
+		arg.InterestedIn,
 	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+const listExcludedUserIDs = `-- name: ListExcludedUserIDs :many
+SELECT id FROM (
+  SELECT user_swiped_on AS id, created_at FROM swipes
+  WHERE user_swiped = ?
+  UNION ALL
+  SELECT IF(user_id_1 = ?, user_id_2, user_id_1) AS id, created_at FROM matches
+  WHERE user_id_1 = ? OR user_id_2 = ?
+) AS excluded
+GROUP BY id
+ORDER BY MAX(created_at) DESC, id DESC
+LIMIT ?
+`
+
+type ListExcludedUserIDsParams struct {
+	UserID int64
+	Limit  int32
+}
+
+func (q *Queries) ListExcludedUserIDs(ctx context.Context, arg ListExcludedUserIDsParams) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, listExcludedUserIDs,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listIncomingSwipeStats = `-- name: ListIncomingSwipeStats :many
+SELECT s.user_swiped_on, u.desirability,
+  CAST(SUM(IF(s.swipe_type = 'right', sel.weight, 0)) AS DOUBLE) AS weighted_rights,
+  CAST(SUM(sel.weight) AS DOUBLE) AS weighted_total
+FROM swipes s
+JOIN (
+  SELECT user_swiped, GREATEST(1 - AVG(swipe_type = 'right'), ?) AS weight
+  FROM swipes
+  GROUP BY user_swiped
+) sel ON sel.user_swiped = s.user_swiped
+JOIN users u ON u.id = s.user_swiped_on
+GROUP BY s.user_swiped_on, u.desirability
+`
+
+type ListIncomingSwipeStatsRow struct {
+	UserSwipedOn   int64
+	Desirability   float64
+	WeightedRights float64
+	WeightedTotal  float64
+}
+
+func (q *Queries) ListIncomingSwipeStats(ctx context.Context, minWeight interface{}) ([]ListIncomingSwipeStatsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listIncomingSwipeStats, minWeight)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListIncomingSwipeStatsRow
+	for rows.Next() {
+		var i ListIncomingSwipeStatsRow
+		if err := rows.Scan(
+			&i.UserSwipedOn,
+			&i.Desirability,
+			&i.WeightedRights,
+			&i.WeightedTotal,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSwipedOnByUser = `-- name: ListSwipedOnByUser :many
+SELECT id, user_swiped_on FROM swipes
+WHERE user_swiped = ? AND id > ?
+ORDER BY id
+LIMIT ?
+`
+
+type ListSwipedOnByUserParams struct {
+	UserSwiped int64
+	ID         int64
+	Limit      int32
+}
+
+type ListSwipedOnByUserRow struct {
+	ID           int64
+	UserSwipedOn int64
+}
+
+func (q *Queries) ListSwipedOnByUser(ctx context.Context, arg ListSwipedOnByUserParams) ([]ListSwipedOnByUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, listSwipedOnByUser, arg.UserSwiped, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListSwipedOnByUserRow
+	for rows.Next() {
+		var i ListSwipedOnByUserRow
+		if err := rows.Scan(&i.ID, &i.UserSwipedOn); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserIDs = `-- name: ListUserIDs :many
+SELECT id FROM users
+WHERE id > ?
+ORDER BY id
+LIMIT ?
+`
+
+type ListUserIDsParams struct {
+	ID    int64
+	Limit int32
+}
+
+func (q *Queries) ListUserIDs(ctx context.Context, arg ListUserIDsParams) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, listUserIDs, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setPasswordHash = `-- name: SetPasswordHash :exec
+INSERT INTO user_credentials (user_id, password_hash)
+VALUES (?, ?)
+ON DUPLICATE KEY UPDATE password_hash = VALUES(password_hash)
+`
+
+type SetPasswordHashParams struct {
+	UserID       int64
+	PasswordHash string
+}
+
+func (q *Queries) SetPasswordHash(ctx context.Context, arg SetPasswordHashParams) error {
+	_, err := q.db.ExecContext(ctx, setPasswordHash, arg.UserID, arg.PasswordHash)
+	return err
+}
+
+const updateDesirability = `-- name: UpdateDesirability :exec
+UPDATE users SET desirability = ?, updated_at = updated_at
+WHERE id = ?
+`
+
+type UpdateDesirabilityParams struct {
+	Desirability float64
+	ID           int64
+}
+
+func (q *Queries) UpdateDesirability(ctx context.Context, arg UpdateDesirabilityParams) error {
+	_, err := q.db.ExecContext(ctx, updateDesirability, arg.Desirability, arg.ID)
 	return err
 }
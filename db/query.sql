@@ -1,16 +1,73 @@
 -- name: GetUser :one
 SELECT * FROM users
-WHERE id = $1
+WHERE id = ?
 LIMIT 1;
 
--- name: InsertUser :exec
-INSERT INTO users (first_name, last_name, bio, latitude, longitude)
-VALUES (?, ?, ?, ?, ?);
+-- name: InsertUser :execlastid
+INSERT INTO users (first_name, last_name, bio, latitude, longitude, birthdate, gender, interested_in)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?);
 
--- name: InsertMatch :exec
+-- name: HasMutualRightSwipes :one
+SELECT COUNT(DISTINCT user_swiped) = 2 AS mutual FROM swipes
+WHERE swipe_type = 'right'
+  AND ((user_swiped = sqlc.arg(user_a) AND user_swiped_on = sqlc.arg(user_b))
+    OR (user_swiped = sqlc.arg(user_b) AND user_swiped_on = sqlc.arg(user_a)));
+
+-- name: GetPasswordHash :one
+SELECT password_hash FROM user_credentials
+WHERE user_id = ?;
+
+-- name: SetPasswordHash :exec
+INSERT INTO user_credentials (user_id, password_hash)
+VALUES (?, ?)
+ON DUPLICATE KEY UPDATE password_hash = VALUES(password_hash);
+
+-- name: InsertMatch :execlastid
 INSERT INTO matches (user_id_1, user_id_2)
-VALUES (?, ?);
+VALUES (?, ?)
+ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id);
 
 -- name: InsertSwipe :exec
 INSERT INTO swipes (user_swiped, user_swiped_on, swipe_type)
 VALUES (?, ?, ?);
+
+-- name: ListSwipedOnByUser :many
+SELECT id, user_swiped_on FROM swipes
+WHERE user_swiped = ? AND id > ?
+ORDER BY id
+LIMIT ?;
+
+-- name: ListUserIDs :many
+SELECT id FROM users
+WHERE id > ?
+ORDER BY id
+LIMIT ?;
+
+-- name: ListIncomingSwipeStats :many
+SELECT s.user_swiped_on, u.desirability,
+  CAST(SUM(IF(s.swipe_type = 'right', sel.weight, 0)) AS DOUBLE) AS weighted_rights,
+  CAST(SUM(sel.weight) AS DOUBLE) AS weighted_total
+FROM swipes s
+JOIN (
+  SELECT user_swiped, GREATEST(1 - AVG(swipe_type = 'right'), sqlc.arg(min_weight)) AS weight
+  FROM swipes
+  GROUP BY user_swiped
+) sel ON sel.user_swiped = s.user_swiped
+JOIN users u ON u.id = s.user_swiped_on
+GROUP BY s.user_swiped_on, u.desirability;
+
+-- name: UpdateDesirability :exec
+UPDATE users SET desirability = ?, updated_at = updated_at
+WHERE id = ?;
+
+-- name: ListExcludedUserIDs :many
+SELECT id FROM (
+  SELECT user_swiped_on AS id, created_at FROM swipes
+  WHERE user_swiped = sqlc.arg(user_id)
+  UNION ALL
+  SELECT IF(user_id_1 = sqlc.arg(user_id), user_id_2, user_id_1) AS id, created_at FROM matches
+  WHERE user_id_1 = sqlc.arg(user_id) OR user_id_2 = sqlc.arg(user_id)
+) AS excluded
+GROUP BY id
+ORDER BY MAX(created_at) DESC, id DESC
+LIMIT ?;
@@ -5,13 +5,19 @@ CREATE TABLE users (
   bio TEXT NOT NULL,
   latitude DECIMAL(9,6) NOT NULL,
   longitude DECIMAL(9,6) NOT NULL,
-  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  birthdate DATE,
+  gender ENUM('man', 'woman', 'nonbinary'),
+  interested_in SET('man', 'woman', 'nonbinary') NOT NULL DEFAULT '',
+  desirability DOUBLE NOT NULL DEFAULT 0.5
 );
 
 CREATE TABLE matches (
   id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
   user_id_1 BIGINT NOT NULL,
   user_id_2 BIGINT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE KEY uniq_match_pair (user_id_1, user_id_2),
   FOREIGN KEY (user_id_1) REFERENCES users(id),
   FOREIGN KEY (user_id_2) REFERENCES users(id)
 );
@@ -21,6 +27,13 @@ CREATE TABLE swipes (
   user_swiped BIGINT NOT NULL,
   user_swiped_on BIGINT NOT NULL,
   swipe_type ENUM('left', 'right') NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
   FOREIGN KEY (user_swiped) REFERENCES users(id),
   FOREIGN KEY (user_swiped_on) REFERENCES users(id)
 );
+
+CREATE TABLE user_credentials (
+  user_id BIGINT NOT NULL PRIMARY KEY,
+  password_hash VARCHAR(60) NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id)
+);
@@ -6,7 +6,11 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"regexp"
 	"strings"
 	"time"
 
@@ -15,55 +19,190 @@ import (
 )
 
 type ES struct {
-	Cl    *elasticsearch.Client
-	Bi    esutil.BulkIndexer
-	Index string
+	Cl      *elasticsearch.Client
+	Bi      esutil.BulkIndexer
+	Index   string
+	Ranking RankingConfig
 }
 
-func NewClient(cloudID string, index string, apiKey string) (*elasticsearch.Client, esutil.BulkIndexer, string, error) {
+// ClientConfig says how to reach and authenticate to Elasticsearch. Set
+// either CloudID or Addresses, and at most one of APIKey and
+// Username/Password.
+//
+// TLS certificates are verified against the system roots, plus the CA in
+// the PEM file at CACertPath if set. CertificateFingerprint instead pins the
+// SHA-256 fingerprint of the certificate Elasticsearch prints on first
+// start. InsecureSkipVerify turns verification off and is meant for local
+// development only.
+type ClientConfig struct {
+	Addresses              []string `yaml:"addresses"`
+	CloudID                string   `yaml:"cloud_id"`
+	APIKey                 string   `yaml:"api_key"`
+	Username               string   `yaml:"username"`
+	Password               string   `yaml:"password"`
+	CACertPath             string   `yaml:"ca_cert"`
+	CertificateFingerprint string   `yaml:"certificate_fingerprint"`
+	InsecureSkipVerify     bool     `yaml:"insecure_skip_verify"`
+}
+
+var fingerprintPattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+func (c ClientConfig) Validate() error {
+	if (c.CloudID == "") == (len(c.Addresses) == 0) {
+		return fmt.Errorf("set exactly one of cloud ID and addresses")
+	}
+	for _, addr := range c.Addresses {
+		u, err := url.Parse(addr)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid address %q", addr)
+		}
+	}
+	if c.APIKey != "" && c.Username != "" {
+		return fmt.Errorf("set either an API key or a username, not both")
+	}
+	if c.Password != "" && c.Username == "" {
+		return fmt.Errorf("password set without a username")
+	}
+	if c.CertificateFingerprint != "" && !fingerprintPattern.MatchString(c.fingerprint()) {
+		return fmt.Errorf("certificate fingerprint must be a hex SHA-256 digest")
+	}
+	if c.InsecureSkipVerify && (c.CACertPath != "" || c.CertificateFingerprint != "") {
+		return fmt.Errorf("insecure_skip_verify contradicts the configured CA certificate or fingerprint")
+	}
+	return nil
+}
+
+// fingerprint accepts the colon-separated form openssl prints.
+func (c ClientConfig) fingerprint() string {
+	return strings.ReplaceAll(c.CertificateFingerprint, ":", "")
+}
+
+func (c ClientConfig) elasticsearchConfig() (elasticsearch.Config, error) {
 	cfg := elasticsearch.Config{
-		APIKey: apiKey,
-		Transport: &http.Transport{
+		Addresses:              c.Addresses,
+		CloudID:                c.CloudID,
+		APIKey:                 c.APIKey,
+		Username:               c.Username,
+		Password:               c.Password,
+		CertificateFingerprint: c.fingerprint(),
+	}
+	if c.CACertPath != "" {
+		caCert, err := os.ReadFile(c.CACertPath)
+		if err != nil {
+			return cfg, fmt.Errorf("error reading CA certificate: %w", err)
+		}
+		cfg.CACert = caCert
+	}
+	if c.InsecureSkipVerify {
+		log.Println("Elasticsearch TLS certificate verification is disabled")
+		cfg.Transport = &http.Transport{
 			TLSClientConfig: &tls.Config{
 				InsecureSkipVerify: true,
 			},
-		},
-		CloudID: cloudID,
+		}
 	}
+	return cfg, nil
+}
 
-	cl, err := elasticsearch.NewClient(cfg)
+// NewClient connects to Elasticsearch, makes sure the users index exists and
+// starts a BulkIndexer writing to it.
+func NewClient(clientCfg ClientConfig, index string) (*elasticsearch.Client, esutil.BulkIndexer, string, error) {
+	cl, err := NewElasticsearchClient(clientCfg)
+	if err != nil {
+		return nil, nil, "", err
+	}
 
+	if err := EnsureIndex(cl, index, RoleUsers); err != nil {
+		return nil, nil, "", err
+	}
+
+	bi, err := NewBulkIndexer(cl, index)
 	if err != nil {
 		return nil, nil, "", err
 	}
 
-	bi, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+	return cl, bi, index, nil
+}
+
+// NewElasticsearchClient only builds the client, for callers that write to
+// other indices or only read.
+func NewElasticsearchClient(clientCfg ClientConfig) (*elasticsearch.Client, error) {
+	if err := clientCfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid Elasticsearch config: %w", err)
+	}
+	cfg, err := clientCfg.elasticsearchConfig()
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearch.NewClient(cfg)
+}
+
+func NewBulkIndexer(cl *elasticsearch.Client, index string) (esutil.BulkIndexer, error) {
+	return esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
 		Index:      index,
 		Client:     cl,
 		NumWorkers: 10,
 	})
+}
 
-	if err != nil {
-		return nil, nil, "", err
+// EnsureIndex creates index with the mapping for role if it does not exist
+// yet. Creating an existing index fails with resource_already_exists_exception,
+// which is ignored; the mapping is then put again separately to pick up
+// fields added since the index was created. Any other failure is returned.
+func EnsureIndex(cl *elasticsearch.Client, index string, role IndexRole) error {
+	properties, ok := indexProperties[role]
+	if !ok {
+		return fmt.Errorf("no mapping for index role %q", role)
 	}
 
-	mapping := `{
-		"mappings": {
-			"properties": {
-				"location_user": {
-					"type": "geo_point"
-				}
-			}
+	mapping := fmt.Sprintf(`{"mappings": %s}`, properties)
+	res, err := cl.Indices.Create(index, cl.Indices.Create.WithBody(strings.NewReader(mapping)))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		var body struct {
+			Error struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			return fmt.Errorf("error creating %s: %s", index, res.Status())
 		}
-	}`
+		// An existing index is fine; its mapping is brought up to date below.
+		if body.Error.Type != "resource_already_exists_exception" {
+			return fmt.Errorf("error creating %s: %s: %s", index, body.Error.Type, body.Error.Reason)
+		}
+	}
 
-	_, err = cl.Indices.Create(index, cl.Indices.Create.WithBody(strings.NewReader(mapping)))
+	res, err = cl.Indices.PutMapping([]string{index}, strings.NewReader(properties))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("error updating mapping of %s: %s", index, res.String())
+	}
+	return nil
+}
 
+func (e *ES) Ping(ctx context.Context) error {
+	res, err := e.Cl.Ping(e.Cl.Ping.WithContext(ctx))
 	if err != nil {
-		return nil, nil, "", err
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("error pinging Elasticsearch: %s", res.Status())
 	}
+	return nil
+}
 
-	return cl, bi, index, nil
+// Close flushes documents still buffered in the BulkIndexer and stops it.
+func (e *ES) Close(ctx context.Context) error {
+	return e.Bi.Close(ctx)
 }
 
 func (e *ES) IndexData(msg []byte) error {
@@ -94,11 +233,18 @@ type LocationUser struct {
 }
 
 type User struct {
+	ID           int64        `json:"id"`
 	FirstName    string       `json:"first_name"`
 	LastName     string       `json:"last_name"`
 	Bio          string       `json:"bio"`
 	LocationUser LocationUser `json:"location_user"`
 	UpdatedAt    time.Time    `json:"updated_at"`
+	Birthdate    string       `json:"birthdate,omitempty"`
+	Gender       string       `json:"gender,omitempty"`
+	InterestedIn []string     `json:"interested_in,omitempty"`
+	// Score is the ranking score of a search hit, returned for debugging.
+	// It is not part of the indexed document.
+	Score float64 `json:"score,omitempty"`
 }
 
 type ESSearchResponse struct {
@@ -115,28 +261,24 @@ type ESSearchResponse struct {
 }
 
 type ESSearchHit struct {
-	Index  string  `json:"_index"`
-	ID     string  `json:"_id"`
-	Score  float64 `json:"_score"`
-	Source User    `json:"_source"`
-}
-
-func (e *ES) RetrieveUserFilteredData(index string, userLat string, userLong string, distance string) ([]ESSearchHit, error) {
-	query := fmt.Sprintf(`{
-        "query": {
-            "geo_distance": {
-                "distance": %s,
-                "location_user": {
-                    "lat": %s,
-                    "lon": %s
-                }
-            }
-        }
-    }`, distance, userLat, userLong)
+	Index  string        `json:"_index"`
+	ID     string        `json:"_id"`
+	Score  float64       `json:"_score"`
+	Source User          `json:"_source"`
+	Sort   []interface{} `json:"sort"`
+}
+
+// RetrieveUserFilteredData runs search against index. Pass the Sort values
+// of the last hit as search.SearchAfter to fetch the next page.
+func (e *ES) RetrieveUserFilteredData(index string, search UserSearch) ([]ESSearchHit, error) {
+	query, err := search.Build()
+	if err != nil {
+		return nil, fmt.Errorf("invalid search: %w", err)
+	}
 
 	res, err := e.Cl.Search(
 		e.Cl.Search.WithIndex(index),
-		e.Cl.Search.WithBody(strings.NewReader(query)),
+		e.Cl.Search.WithBody(bytes.NewReader(query)),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error executing search request: %v", err)
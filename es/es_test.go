@@ -0,0 +1,53 @@
+package es
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+func TestEnsureIndex(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantErr    bool
+		wantMapped bool
+	}{
+		{name: "created", status: 200, body: `{"acknowledged":true}`, wantMapped: true},
+		{name: "already exists", status: 400, body: `{"error":{"type":"resource_already_exists_exception","reason":"index [users/x] already exists"}}`, wantMapped: true},
+		{name: "forbidden", status: 403, body: `{"error":{"type":"security_exception","reason":"action [indices:admin/create] is unauthorized"}}`, wantErr: true},
+		{name: "bad mapping", status: 400, body: `{"error":{"type":"mapper_parsing_exception","reason":"unknown parameter"}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapped := false
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Elastic-Product", "Elasticsearch")
+				w.Header().Set("Content-Type", "application/json")
+				if r.Method == http.MethodPut && r.URL.Path == "/users/_mapping" {
+					mapped = true
+					w.Write([]byte(`{"acknowledged":true}`))
+					return
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			cl, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{srv.URL}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = EnsureIndex(cl, "users", RoleUsers)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("EnsureIndex error = %v, want error %v", err, tt.wantErr)
+			}
+			if mapped != tt.wantMapped {
+				t.Errorf("mapping put = %v, want %v", mapped, tt.wantMapped)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package es
+
+// IndexRole names what an index holds, independently of the index name it
+// is deployed under.
+type IndexRole string
+
+const (
+	RoleUsers   IndexRole = "users"
+	RoleSwipes  IndexRole = "swipes"
+	RoleMatches IndexRole = "matches"
+)
+
+// DeletedField marks tombstones: documents whose row was deleted, kept so
+// that their external version still rejects older writes. Searches must
+// exclude them.
+const DeletedField = "deleted"
+
+// indexProperties holds the mapping properties of every kind of index the
+// app writes to.
+var indexProperties = map[IndexRole]string{
+	RoleUsers: `{
+		"properties": {
+			"location_user": {
+				"type": "geo_point"
+			},
+			"birthdate": {
+				"type": "date",
+				"format": "yyyy-MM-dd"
+			},
+			"gender": {
+				"type": "keyword"
+			},
+			"interested_in": {
+				"type": "keyword"
+			},
+			"desirability": {
+				"type": "float"
+			},
+			"deleted": {
+				"type": "boolean"
+			}
+		}
+	}`,
+	// The analytics indices hold one document per swipe or match, carrying
+	// both users' locations so they can be aggregated by region.
+	RoleSwipes: `{
+		"properties": {
+			"id": {
+				"type": "long"
+			},
+			"swiper_id": {
+				"type": "long"
+			},
+			"swiped_on_id": {
+				"type": "long"
+			},
+			"direction": {
+				"type": "keyword"
+			},
+			"created_at": {
+				"type": "date"
+			},
+			"swiper_location": {
+				"type": "geo_point"
+			},
+			"swiped_on_location": {
+				"type": "geo_point"
+			},
+			"deleted": {
+				"type": "boolean"
+			}
+		}
+	}`,
+	RoleMatches: `{
+		"properties": {
+			"id": {
+				"type": "long"
+			},
+			"user_id_1": {
+				"type": "long"
+			},
+			"user_id_2": {
+				"type": "long"
+			},
+			"created_at": {
+				"type": "date"
+			},
+			"user_1_location": {
+				"type": "geo_point"
+			},
+			"user_2_location": {
+				"type": "geo_point"
+			},
+			"deleted": {
+				"type": "boolean"
+			}
+		}
+	}`,
+}
@@ -0,0 +1,274 @@
+package es
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// distanceUnits are the units Elasticsearch accepts for geo distances.
+var distanceUnits = map[string]bool{
+	"mi": true, "miles": true,
+	"yd": true, "yards": true,
+	"ft": true, "feet": true,
+	"in": true, "inch": true,
+	"km": true, "kilometers": true,
+	"m": true, "meters": true,
+	"cm": true, "centimeters": true,
+	"mm": true, "millimeters": true,
+	"NM": true, "nmi": true, "nauticalmiles": true,
+}
+
+var distancePattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)([A-Za-z]+)$`)
+
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+func ParseGeoPoint(lat string, lon string) (GeoPoint, error) {
+	latitude, err := strconv.ParseFloat(lat, 64)
+	if err != nil {
+		return GeoPoint{}, fmt.Errorf("invalid latitude %q", lat)
+	}
+	longitude, err := strconv.ParseFloat(lon, 64)
+	if err != nil {
+		return GeoPoint{}, fmt.Errorf("invalid longitude %q", lon)
+	}
+	p := GeoPoint{Lat: latitude, Lon: longitude}
+	return p, p.Validate()
+}
+
+func (p GeoPoint) Validate() error {
+	if math.IsNaN(p.Lat) || p.Lat < -90 || p.Lat > 90 {
+		return fmt.Errorf("latitude %v out of range [-90, 90]", p.Lat)
+	}
+	if math.IsNaN(p.Lon) || p.Lon < -180 || p.Lon > 180 {
+		return fmt.Errorf("longitude %v out of range [-180, 180]", p.Lon)
+	}
+	return nil
+}
+
+// Distance is a positive geo distance with an Elasticsearch unit, such as
+// 50km. It marshals to and from its string form.
+type Distance struct {
+	Value float64
+	Unit  string
+}
+
+func ParseDistance(s string) (Distance, error) {
+	match := distancePattern.FindStringSubmatch(s)
+	if match == nil {
+		return Distance{}, fmt.Errorf("invalid distance %q", s)
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return Distance{}, fmt.Errorf("invalid distance %q", s)
+	}
+	d := Distance{Value: value, Unit: match[2]}
+	return d, d.Validate()
+}
+
+func (d Distance) Validate() error {
+	if !(d.Value > 0) || math.IsInf(d.Value, 0) {
+		return fmt.Errorf("distance must be positive, got %v", d.Value)
+	}
+	if !distanceUnits[d.Unit] {
+		return fmt.Errorf("unknown distance unit %q", d.Unit)
+	}
+	return nil
+}
+
+func (d Distance) String() string {
+	return strconv.FormatFloat(d.Value, 'f', -1, 64) + d.Unit
+}
+
+func (d Distance) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Distance) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return d.UnmarshalText([]byte(s))
+}
+
+// UnmarshalText lets a distance be written as "10km" in config files.
+func (d *Distance) UnmarshalText(text []byte) error {
+	parsed, err := ParseDistance(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// UserSearch describes a feed query against the users index: everyone within
+// Distance of Location minus ExcludeIDs and deleted users. Results are ordered by Ranking when
+// it is set and nearest first otherwise. SearchAfter takes the sort values of
+// the previous page's last hit. RankedAt is the origin of the recency decay;
+// pages of one feed must share it, or scores drift between pages and
+// search_after skips or repeats candidates. It defaults to the time of the
+// search.
+//
+// The preference fields are optional. Genders restricts candidates to those
+// genders, InterestedIn to candidates interested in that gender, and
+// MinAge/MaxAge to candidates whose age falls in the inclusive range.
+type UserSearch struct {
+	Location     GeoPoint
+	Distance     Distance
+	ExcludeIDs   []int64
+	Size         int
+	SearchAfter  []interface{}
+	Genders      []string
+	InterestedIn string
+	MinAge       int
+	MaxAge       int
+	Ranking      *RankingConfig
+	RankedAt     time.Time
+}
+
+func (s UserSearch) Validate() error {
+	if err := s.Location.Validate(); err != nil {
+		return err
+	}
+	if err := s.Distance.Validate(); err != nil {
+		return err
+	}
+	if s.Size < 0 {
+		return fmt.Errorf("size must not be negative, got %d", s.Size)
+	}
+	if s.MinAge < 0 || s.MaxAge < 0 || (s.MaxAge != 0 && s.MaxAge < s.MinAge) {
+		return fmt.Errorf("invalid age range [%d, %d]", s.MinAge, s.MaxAge)
+	}
+	if s.Ranking != nil {
+		if err := s.Ranking.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, v := range s.SearchAfter {
+		switch v.(type) {
+		case float64, int64, string, json.Number:
+		default:
+			return fmt.Errorf("unsupported search_after value %v (%T)", v, v)
+		}
+	}
+	return nil
+}
+
+type searchRequest struct {
+	Size        int           `json:"size"`
+	SearchAfter []interface{} `json:"search_after,omitempty"`
+	Sort        []interface{} `json:"sort"`
+	Query       interface{}   `json:"query"`
+}
+
+type boolQuery struct {
+	Bool boolClauses `json:"bool"`
+}
+
+type boolClauses struct {
+	Filter  []interface{} `json:"filter,omitempty"`
+	MustNot []interface{} `json:"must_not,omitempty"`
+}
+
+type geoDistanceQuery struct {
+	GeoDistance map[string]interface{} `json:"geo_distance"`
+}
+
+type termsQuery struct {
+	Terms map[string]interface{} `json:"terms"`
+}
+
+type termQuery struct {
+	Term map[string]string `json:"term"`
+}
+
+type rangeQuery struct {
+	Range map[string]map[string]string `json:"range"`
+}
+
+// ageRange turns an inclusive age range into a birthdate range using date
+// math, so Elasticsearch resolves it against the current date.
+func ageRange(minAge int, maxAge int) rangeQuery {
+	bounds := map[string]string{}
+	if minAge > 0 {
+		bounds["lte"] = fmt.Sprintf("now-%dy/d", minAge)
+	}
+	if maxAge > 0 {
+		bounds["gt"] = fmt.Sprintf("now-%dy/d", maxAge+1)
+	}
+	return rangeQuery{Range: map[string]map[string]string{"birthdate": bounds}}
+}
+
+type geoDistanceSort struct {
+	GeoDistance map[string]interface{} `json:"_geo_distance"`
+}
+
+// Build validates the search and marshals it into a request body. Nothing is
+// spliced in as raw text, so request values cannot change the query shape.
+func (s UserSearch) Build() ([]byte, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	query := boolQuery{
+		Bool: boolClauses{
+			Filter: []interface{}{
+				geoDistanceQuery{GeoDistance: map[string]interface{}{
+					"distance":      s.Distance,
+					"location_user": s.Location,
+				}},
+			},
+		},
+	}
+	if len(s.Genders) > 0 {
+		query.Bool.Filter = append(query.Bool.Filter,
+			termsQuery{Terms: map[string]interface{}{"gender": s.Genders}})
+	}
+	if s.InterestedIn != "" {
+		query.Bool.Filter = append(query.Bool.Filter,
+			termQuery{Term: map[string]string{"interested_in": s.InterestedIn}})
+	}
+	if s.MinAge > 0 || s.MaxAge > 0 {
+		query.Bool.Filter = append(query.Bool.Filter, ageRange(s.MinAge, s.MaxAge))
+	}
+	query.Bool.MustNot = []interface{}{
+		termQuery{Term: map[string]string{DeletedField: "true"}},
+	}
+	if len(s.ExcludeIDs) > 0 {
+		query.Bool.MustNot = append(query.Bool.MustNot,
+			termsQuery{Terms: map[string]interface{}{"id": s.ExcludeIDs}})
+	}
+
+	// id breaks ties so that search_after pages are stable.
+	if s.Ranking != nil {
+		return json.Marshal(searchRequest{
+			Size:        s.Size,
+			SearchAfter: s.SearchAfter,
+			Sort: []interface{}{
+				map[string]string{"_score": "desc"},
+				map[string]string{"id": "asc"},
+			},
+			Query: s.Ranking.rank(query, s.Location, s.RankedAt),
+		})
+	}
+
+	return json.Marshal(searchRequest{
+		Size:        s.Size,
+		SearchAfter: s.SearchAfter,
+		Sort: []interface{}{
+			geoDistanceSort{GeoDistance: map[string]interface{}{
+				"location_user": s.Location,
+				"order":         "asc",
+			}},
+			map[string]string{"id": "asc"},
+		},
+		Query: query,
+	})
+}
@@ -0,0 +1,202 @@
+package es
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDistance(t *testing.T) {
+	for unit := range distanceUnits {
+		d, err := ParseDistance("12.5" + unit)
+		if err != nil {
+			t.Errorf("unit %q rejected: %v", unit, err)
+			continue
+		}
+		if d.Value != 12.5 || d.Unit != unit {
+			t.Errorf("ParseDistance(%q) = %+v", "12.5"+unit, d)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"km",
+		"10",
+		"10 km",
+		"0km",
+		"-5km",
+		"1e3km",
+		"NaNkm",
+		"10parsecs",
+		"10KM",
+		`10km"}}`,
+		`10km","location_user":{"lat":0,"lon":0}`,
+		"10km\n",
+	}
+	for _, s := range invalid {
+		if d, err := ParseDistance(s); err == nil {
+			t.Errorf("ParseDistance(%q) = %+v, want error", s, d)
+		}
+	}
+}
+
+func TestParseGeoPoint(t *testing.T) {
+	tests := []struct {
+		lat     string
+		lon     string
+		want    GeoPoint
+		wantErr string
+	}{
+		{lat: "40.712776", lon: "-74.005974", want: GeoPoint{Lat: 40.712776, Lon: -74.005974}},
+		{lat: "-90", lon: "180", want: GeoPoint{Lat: -90, Lon: 180}},
+		{lat: "90.0001", lon: "0", wantErr: "latitude"},
+		{lat: "0", lon: "-180.5", wantErr: "longitude"},
+		{lat: "NaN", lon: "0", wantErr: "latitude"},
+		{lat: "0", lon: "Inf", wantErr: "longitude"},
+		{lat: "", lon: "0", wantErr: "latitude"},
+		{lat: `40.7,"lon":0},"x":{"lat":1`, lon: "0", wantErr: "latitude"},
+		{lat: "0", lon: "-74 OR 1=1", wantErr: "longitude"},
+	}
+	for _, tt := range tests {
+		p, err := ParseGeoPoint(tt.lat, tt.lon)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseGeoPoint(%q, %q) error = %v, want it to mention %q", tt.lat, tt.lon, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseGeoPoint(%q, %q): %v", tt.lat, tt.lon, err)
+			continue
+		}
+		if p != tt.want {
+			t.Errorf("ParseGeoPoint(%q, %q) = %+v, want %+v", tt.lat, tt.lon, p, tt.want)
+		}
+	}
+}
+
+func TestUserSearchValidate(t *testing.T) {
+	valid := UserSearch{
+		Location: GeoPoint{Lat: 1, Lon: 2},
+		Distance: Distance{Value: 10, Unit: "km"},
+		Size:     10,
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid search rejected: %v", err)
+	}
+
+	tests := map[string]func(*UserSearch){
+		"location":     func(s *UserSearch) { s.Location.Lat = 100 },
+		"distance":     func(s *UserSearch) { s.Distance = Distance{Value: 10, Unit: "lightyears"} },
+		"size":         func(s *UserSearch) { s.Size = -1 },
+		"age range":    func(s *UserSearch) { s.MinAge, s.MaxAge = 40, 30 },
+		"search_after": func(s *UserSearch) { s.SearchAfter = []interface{}{map[string]interface{}{"script": "x"}} },
+		"ranking":      func(s *UserSearch) { s.Ranking = &RankingConfig{} },
+	}
+	for name, mutate := range tests {
+		s := valid
+		mutate(&s)
+		if err := s.Validate(); err == nil {
+			t.Errorf("%s: invalid search accepted", name)
+		}
+	}
+}
+
+func TestUserSearchBuild(t *testing.T) {
+	ranking := DefaultRankingConfig()
+	base := UserSearch{
+		Location:     GeoPoint{Lat: 40.712776, Lon: -74.005974},
+		Distance:     Distance{Value: 25, Unit: "km"},
+		ExcludeIDs:   []int64{7, 9},
+		Size:         20,
+		Genders:      []string{"woman", "nonbinary"},
+		InterestedIn: "man",
+		MinAge:       25,
+		MaxAge:       35,
+	}
+
+	ranked := base
+	ranked.Ranking = &ranking
+	ranked.RankedAt = time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+
+	paged := ranked
+	paged.SearchAfter = []interface{}{1.75, int64(42)}
+
+	tests := []struct {
+		golden string
+		search UserSearch
+	}{
+		{golden: "search_bool.json", search: base},
+		{golden: "search_function_score.json", search: ranked},
+		{golden: "search_after.json", search: paged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			body, err := tt.search.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSONEqual(t, filepath.Join("testdata", tt.golden), body)
+		})
+	}
+}
+
+// TestUserSearchBuildEscapesValues checks that request values land in the
+// body as JSON strings and cannot add clauses of their own.
+func TestUserSearchBuildEscapesValues(t *testing.T) {
+	injected := `man"}},{"match_all":{}}]}}`
+	body, err := UserSearch{
+		Location:     GeoPoint{Lat: 1, Lon: 2},
+		Distance:     Distance{Value: 10, Unit: "km"},
+		InterestedIn: injected,
+		Genders:      []string{injected},
+	}.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var request struct {
+		Query struct {
+			Bool struct {
+				Filter []map[string]map[string]interface{} `json:"filter"`
+			} `json:"bool"`
+		} `json:"query"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		t.Fatal(err)
+	}
+	filters := request.Query.Bool.Filter
+	if len(filters) != 3 {
+		t.Fatalf("got %d filters, want 3: %s", len(filters), body)
+	}
+	if got := filters[1]["terms"]["gender"].([]interface{})[0]; got != injected {
+		t.Errorf("gender = %q, want %q", got, injected)
+	}
+	if got := filters[2]["term"]["interested_in"]; got != injected {
+		t.Errorf("interested_in = %q, want %q", got, injected)
+	}
+}
+
+// assertJSONEqual compares got against the golden file by value, so that
+// the golden file can be indented for reading.
+func assertJSONEqual(t *testing.T, golden string, got []byte) {
+	t.Helper()
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wantBuf, gotBuf bytes.Buffer
+	if err := json.Compact(&wantBuf, want); err != nil {
+		t.Fatalf("%s: %v", golden, err)
+	}
+	if err := json.Compact(&gotBuf, got); err != nil {
+		t.Fatal(err)
+	}
+	if wantBuf.String() != gotBuf.String() {
+		t.Errorf("body does not match %s\n got: %s\nwant: %s", golden, gotBuf.String(), wantBuf.String())
+	}
+}
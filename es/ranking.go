@@ -0,0 +1,158 @@
+package es
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var durationPattern = regexp.MustCompile(`^[0-9]+(ms|s|m|h|d)$`)
+
+// RankingConfig controls how feed candidates are ordered. Each signal is a
+// function_score function whose result is multiplied by its weight; the
+// weighted results are summed into the hit's score.
+//
+//   - Distance: Gaussian decay from the requester's location on
+//     location_user, falling to DistanceDecay at DistanceScale.
+//   - Recency: Gaussian decay from the search time on updated_at, falling to
+//     RecencyDecay at RecencyScale, so recently active users rank higher.
+//   - Score: the numeric per-user field named by ScoreField, taken as is.
+//     Users without the field count as ScoreMissing.
+type RankingConfig struct {
+	DistanceWeight float64  `yaml:"distance_weight"`
+	DistanceScale  Distance `yaml:"distance_scale"`
+	DistanceDecay  float64  `yaml:"distance_decay"`
+
+	RecencyWeight float64 `yaml:"recency_weight"`
+	RecencyScale  string  `yaml:"recency_scale"`
+	RecencyDecay  float64 `yaml:"recency_decay"`
+
+	ScoreWeight  float64 `yaml:"score_weight"`
+	ScoreField   string  `yaml:"score_field"`
+	ScoreMissing float64 `yaml:"score_missing"`
+}
+
+func DefaultRankingConfig() RankingConfig {
+	return RankingConfig{
+		DistanceWeight: 1,
+		DistanceScale:  Distance{Value: 10, Unit: "km"},
+		DistanceDecay:  0.5,
+		RecencyWeight:  0.5,
+		RecencyScale:   "7d",
+		RecencyDecay:   0.5,
+		ScoreWeight:    1,
+		ScoreField:     "desirability",
+		ScoreMissing:   0.5,
+	}
+}
+
+func (c RankingConfig) Validate() error {
+	if c.DistanceWeight < 0 || c.RecencyWeight < 0 || c.ScoreWeight < 0 {
+		return fmt.Errorf("ranking weights must not be negative")
+	}
+	if c.DistanceWeight+c.RecencyWeight+c.ScoreWeight == 0 {
+		return fmt.Errorf("at least one ranking weight must be positive")
+	}
+	if c.DistanceWeight > 0 {
+		if err := c.DistanceScale.Validate(); err != nil {
+			return fmt.Errorf("distance scale: %w", err)
+		}
+		if c.DistanceDecay <= 0 || c.DistanceDecay >= 1 {
+			return fmt.Errorf("distance decay must be in (0, 1), got %v", c.DistanceDecay)
+		}
+	}
+	if c.RecencyWeight > 0 {
+		if !durationPattern.MatchString(c.RecencyScale) {
+			return fmt.Errorf("invalid recency scale %q", c.RecencyScale)
+		}
+		if c.RecencyDecay <= 0 || c.RecencyDecay >= 1 {
+			return fmt.Errorf("recency decay must be in (0, 1), got %v", c.RecencyDecay)
+		}
+	}
+	if c.ScoreWeight > 0 && c.ScoreField == "" {
+		return fmt.Errorf("score field must be set when its weight is positive")
+	}
+	return nil
+}
+
+type functionScoreQuery struct {
+	FunctionScore functionScore `json:"function_score"`
+}
+
+type functionScore struct {
+	Query     interface{}   `json:"query"`
+	Functions []interface{} `json:"functions"`
+	ScoreMode string        `json:"score_mode"`
+	BoostMode string        `json:"boost_mode"`
+}
+
+type gaussFunction struct {
+	Gauss  map[string]decay `json:"gauss"`
+	Weight float64          `json:"weight"`
+}
+
+type decay struct {
+	Origin interface{} `json:"origin"`
+	Scale  interface{} `json:"scale"`
+	Decay  float64     `json:"decay"`
+}
+
+type fieldValueFactorFunction struct {
+	FieldValueFactor fieldValueFactor `json:"field_value_factor"`
+	Weight           float64          `json:"weight"`
+}
+
+type fieldValueFactor struct {
+	Field   string  `json:"field"`
+	Missing float64 `json:"missing"`
+}
+
+// rank wraps query in a function_score that replaces the relevance score
+// with the weighted sum of the configured signals. Recency decays from
+// rankedAt, or from Elasticsearch's now if it is zero.
+func (c RankingConfig) rank(query interface{}, origin GeoPoint, rankedAt time.Time) functionScoreQuery {
+	var recencyOrigin interface{} = "now"
+	if !rankedAt.IsZero() {
+		recencyOrigin = rankedAt.UTC().Format(time.RFC3339)
+	}
+
+	var functions []interface{}
+	if c.DistanceWeight > 0 {
+		functions = append(functions, gaussFunction{
+			Gauss: map[string]decay{"location_user": {
+				Origin: origin,
+				Scale:  c.DistanceScale,
+				Decay:  c.DistanceDecay,
+			}},
+			Weight: c.DistanceWeight,
+		})
+	}
+	if c.RecencyWeight > 0 {
+		functions = append(functions, gaussFunction{
+			Gauss: map[string]decay{"updated_at": {
+				Origin: recencyOrigin,
+				Scale:  c.RecencyScale,
+				Decay:  c.RecencyDecay,
+			}},
+			Weight: c.RecencyWeight,
+		})
+	}
+	if c.ScoreWeight > 0 {
+		functions = append(functions, fieldValueFactorFunction{
+			FieldValueFactor: fieldValueFactor{
+				Field:   c.ScoreField,
+				Missing: c.ScoreMissing,
+			},
+			Weight: c.ScoreWeight,
+		})
+	}
+
+	return functionScoreQuery{
+		FunctionScore: functionScore{
+			Query:     query,
+			Functions: functions,
+			ScoreMode: "sum",
+			BoostMode: "replace",
+		},
+	}
+}
@@ -0,0 +1,77 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const checkTimeout = 2 * time.Second
+
+type healthResponse struct {
+	Status     string            `json:"status"`
+	Components map[string]string `json:"components"`
+}
+
+// check runs the health check of every started component and reports
+// whether all mandatory ones passed.
+func (c *Container) check(ctx context.Context) (bool, map[string]string) {
+	c.mu.Lock()
+	started := c.started
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	healthy := true
+	statuses := make(map[string]string, len(started))
+	for _, component := range started {
+		if component.Check == nil {
+			continue
+		}
+		if err := component.Check(ctx); err != nil {
+			statuses[component.Name] = err.Error()
+			if !component.Optional {
+				healthy = false
+			}
+			continue
+		}
+		statuses[component.Name] = "ok"
+	}
+	return healthy, statuses
+}
+
+// Healthz reports whether the process is alive, along with the result of
+// every component's check. It only fails when the container is not running,
+// so that a dependency outage does not get the process restarted.
+func (c *Container) Healthz(w http.ResponseWriter, r *http.Request) {
+	_, statuses := c.check(r.Context())
+	status := http.StatusOK
+	if !c.ready.Load() {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealth(w, status, statuses)
+}
+
+// Readyz reports whether the process should receive traffic: startup has
+// finished, shutdown has not begun, and every mandatory component's check
+// passes.
+func (c *Container) Readyz(w http.ResponseWriter, r *http.Request) {
+	healthy, statuses := c.check(r.Context())
+	status := http.StatusOK
+	if !c.ready.Load() || !healthy {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealth(w, status, statuses)
+}
+
+func writeHealth(w http.ResponseWriter, status int, statuses map[string]string) {
+	res := healthResponse{Status: "ok", Components: statuses}
+	if status != http.StatusOK {
+		res.Status = "unavailable"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,124 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// Component is a dependency the process starts, stops and health-checks.
+//
+// A mandatory component that fails to start fails the whole startup. An
+// Optional one is logged and skipped, along with every component that
+// depends on it, unless that dependent is mandatory, in which case startup
+// fails too. Stop and Check may be nil.
+type Component struct {
+	Name      string
+	DependsOn []string
+	Optional  bool
+	Start     func(ctx context.Context) error
+	Stop      func(ctx context.Context) error
+	Check     func(ctx context.Context) error
+}
+
+// Container starts components in registration order and stops them in the
+// reverse of the order they started in, so that nothing is stopped while
+// something started after it may still be using it.
+type Container struct {
+	mu         sync.Mutex
+	components []Component
+	started    []Component
+	ready      atomic.Bool
+}
+
+func New() *Container {
+	return &Container{}
+}
+
+// Register adds a component. Its dependencies must have been registered
+// before it.
+func (c *Container) Register(component Component) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.components = append(c.components, component)
+}
+
+// Start starts every registered component. If a mandatory component cannot
+// start, the ones already started are stopped again and the error returned.
+func (c *Container) Start(ctx context.Context) error {
+	c.mu.Lock()
+	components := c.components
+	c.mu.Unlock()
+
+	running := make(map[string]bool, len(components))
+	for _, component := range components {
+		err := checkDependencies(component, running)
+		if err == nil {
+			err = component.Start(ctx)
+		}
+		if err != nil {
+			if component.Optional {
+				log.Printf("Optional component %s unavailable: %v", component.Name, err)
+				continue
+			}
+			startErr := fmt.Errorf("starting %s: %w", component.Name, err)
+			if stopErr := c.Stop(ctx); stopErr != nil {
+				return errors.Join(startErr, stopErr)
+			}
+			return startErr
+		}
+
+		running[component.Name] = true
+		c.mu.Lock()
+		c.started = append(c.started, component)
+		c.mu.Unlock()
+		log.Printf("Started %s", component.Name)
+	}
+
+	c.ready.Store(true)
+	return nil
+}
+
+func checkDependencies(component Component, running map[string]bool) error {
+	for _, dep := range component.DependsOn {
+		if !running[dep] {
+			return fmt.Errorf("dependency %s is not running", dep)
+		}
+	}
+	return nil
+}
+
+// Stop stops the started components, last started first. A failing
+// component does not keep the rest from stopping; all failures are returned
+// together.
+func (c *Container) Stop(ctx context.Context) error {
+	c.ready.Store(false)
+
+	c.mu.Lock()
+	started := c.started
+	c.started = nil
+	c.mu.Unlock()
+
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		if started[i].Stop == nil {
+			continue
+		}
+		log.Printf("Stopping %s", started[i].Name)
+		if err := started[i].Stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stopping %s: %w", started[i].Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SignalContext returns a context that is cancelled on SIGINT or SIGTERM.
+func SignalContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(parent, os.Interrupt, syscall.SIGTERM)
+}
@@ -0,0 +1,154 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// recorder builds components that log their starts and stops, in order.
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) component(name string, startErr error, dependsOn ...string) Component {
+	return Component{
+		Name:      name,
+		DependsOn: dependsOn,
+		Start: func(ctx context.Context) error {
+			if startErr != nil {
+				return startErr
+			}
+			r.events = append(r.events, "start "+name)
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			r.events = append(r.events, "stop "+name)
+			return nil
+		},
+	}
+}
+
+func (r *recorder) optional(name string, startErr error, dependsOn ...string) Component {
+	component := r.component(name, startErr, dependsOn...)
+	component.Optional = true
+	return component
+}
+
+func TestContainerSkipsOptionalComponentAndDependents(t *testing.T) {
+	r := &recorder{}
+	c := New()
+	c.Register(r.component("mysql", nil))
+	c.Register(r.optional("kafka", errors.New("no brokers")))
+	c.Register(r.optional("notifier", nil, "kafka"))
+	c.Register(r.component("api", nil, "mysql"))
+
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if want := []string{"start mysql", "start api"}; !reflect.DeepEqual(r.events, want) {
+		t.Errorf("events = %v, want %v", r.events, want)
+	}
+}
+
+func TestContainerFailsWhenMandatoryDependencyIsDown(t *testing.T) {
+	r := &recorder{}
+	c := New()
+	c.Register(r.component("mysql", nil))
+	c.Register(r.optional("redis", errors.New("connection refused")))
+	c.Register(r.component("api", nil, "mysql", "redis"))
+
+	if err := c.Start(context.Background()); err == nil {
+		t.Fatal("Start succeeded without api's dependency")
+	}
+	if want := []string{"start mysql", "stop mysql"}; !reflect.DeepEqual(r.events, want) {
+		t.Errorf("events = %v, want %v", r.events, want)
+	}
+}
+
+func TestContainerStopsStartedComponentsWhenStartFails(t *testing.T) {
+	r := &recorder{}
+	c := New()
+	c.Register(r.component("mysql", nil))
+	c.Register(r.component("redis", nil))
+	c.Register(r.component("elasticsearch", errors.New("unauthorized")))
+	c.Register(r.component("api", nil))
+
+	err := c.Start(context.Background())
+	if err == nil {
+		t.Fatal("Start succeeded with a failing mandatory component")
+	}
+	want := []string{"start mysql", "start redis", "stop redis", "stop mysql"}
+	if !reflect.DeepEqual(r.events, want) {
+		t.Errorf("events = %v, want %v", r.events, want)
+	}
+}
+
+func TestContainerStopsInReverseOrder(t *testing.T) {
+	r := &recorder{}
+	c := New()
+	c.Register(r.component("mysql", nil))
+	c.Register(r.component("redis", nil))
+	c.Register(r.component("api", nil, "mysql", "redis"))
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	r.events = nil
+
+	if err := c.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if want := []string{"stop api", "stop redis", "stop mysql"}; !reflect.DeepEqual(r.events, want) {
+		t.Errorf("events = %v, want %v", r.events, want)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	down := errors.New("down")
+	tests := []struct {
+		name        string
+		mandatory   error
+		optional    error
+		stopped     bool
+		wantStatus  int
+		wantHealthz int
+	}{
+		{name: "healthy", wantStatus: http.StatusOK, wantHealthz: http.StatusOK},
+		{name: "optional check fails", optional: down, wantStatus: http.StatusOK, wantHealthz: http.StatusOK},
+		{name: "mandatory check fails", mandatory: down, wantStatus: http.StatusServiceUnavailable, wantHealthz: http.StatusOK},
+		{name: "stopped", stopped: true, wantStatus: http.StatusServiceUnavailable, wantHealthz: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{}
+			mysql := r.component("mysql", nil)
+			mysql.Check = func(ctx context.Context) error { return tt.mandatory }
+			kafka := r.optional("kafka", nil)
+			kafka.Check = func(ctx context.Context) error { return tt.optional }
+
+			c := New()
+			c.Register(mysql)
+			c.Register(kafka)
+			if err := c.Start(context.Background()); err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			if tt.stopped {
+				c.Stop(context.Background())
+			}
+
+			rec := httptest.NewRecorder()
+			c.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Readyz status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			rec = httptest.NewRecorder()
+			c.Healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if rec.Code != tt.wantHealthz {
+				t.Errorf("Healthz status = %d, want %d: %s", rec.Code, tt.wantHealthz, rec.Body)
+			}
+		})
+	}
+}
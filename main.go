@@ -4,50 +4,96 @@ import (
 	"binge/api"
 	bloomfilter "binge/bloom_filter"
 	"binge/cache"
+	"binge/config"
 	"binge/db"
 	"binge/es"
+	"binge/lifecycle"
+	"context"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
 	"os"
 
 	"github.com/go-chi/chi"
+	"github.com/segmentio/kafka-go"
 )
 
+// Binge provides the components the API depends on, in start order, and the
+// API built from them once they have started.
 type Binge interface {
-	DBService() error
-	ESService() error
-	CacheService()
-	BloomFilter() error
+	Components() []lifecycle.Component
 	APIService() *chi.Mux
 }
 
-func RunApp(binge Binge) *chi.Mux {
-	err := binge.DBService()
-
-	if err != nil {
-		log.Fatalf("Error setting up DB service: %v", err)
+// RunApp starts binge's components in container and returns the API with
+// health endpoints mounted. Startup fails if a mandatory component does.
+func RunApp(ctx context.Context, binge Binge, container *lifecycle.Container) (*chi.Mux, error) {
+	for _, component := range binge.Components() {
+		container.Register(component)
+	}
+	if err := container.Start(ctx); err != nil {
+		return nil, err
 	}
 
-	binge.CacheService()
-
-	binge.BloomFilter()
-
-	binge.ESService()
-
-	return binge.APIService()
+	r := binge.APIService()
+	r.Get("/healthz", container.Healthz)
+	r.Get("/readyz", container.Readyz)
+	return r, nil
 }
 
 type BingeService struct {
-	db    *db.DB
-	cache *cache.Cache
-	es    *es.ES
-	bf    *bloomfilter.BloomFilterPerUser
+	cfg      *config.Config
+	db       *db.DB
+	cache    *cache.Cache
+	es       *es.ES
+	bf       bloomfilter.Store
+	notifier *bloomfilter.KafkaNotifier
+}
+
+func (b *BingeService) Components() []lifecycle.Component {
+	return []lifecycle.Component{
+		{
+			Name:  "MySQL",
+			Start: b.DBService,
+			Stop:  func(context.Context) error { return b.db.Close() },
+			Check: func(ctx context.Context) error { return b.db.Ping(ctx) },
+		},
+		{
+			Name:  "Redis",
+			Start: b.CacheService,
+			Stop:  func(context.Context) error { return b.cache.Close() },
+			Check: func(ctx context.Context) error { return b.cache.Ping(ctx) },
+		},
+		{
+			Name:  "Elasticsearch",
+			Start: b.ESService,
+			Stop:  func(ctx context.Context) error { return b.es.Close(ctx) },
+			Check: func(ctx context.Context) error { return b.es.Ping(ctx) },
+		},
+		{
+			// Without Kafka, bloom filter resizes are only logged.
+			Name:     "Kafka resize notifier",
+			Optional: true,
+			Start:    b.ResizeNotifier,
+			Stop:     func(context.Context) error { return b.notifier.Close() },
+		},
+		{
+			Name:      "bloom filter",
+			DependsOn: []string{"Redis"},
+			Start:     b.BloomFilter,
+		},
+	}
 }
 
-func (b *BingeService) DBService() error {
-	db, err := db.NewDB(os.Getenv("SQL_USER"), os.Getenv("SQL_PASS"), os.Getenv("GLOBAL_DB"))
+func (b *BingeService) DBService(ctx context.Context) error {
+	mysql := b.cfg.MySQL
+	db, err := db.NewDB(mysql.User, mysql.Password, mysql.Addr, mysql.Database)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if err := db.Ping(ctx); err != nil {
+		db.Close()
 		return err
 	}
 	b.db = db
@@ -55,14 +101,37 @@ func (b *BingeService) DBService() error {
 	return nil
 }
 
-func (b *BingeService) CacheService() {
-	c := cache.NewCache("6379")
+func (b *BingeService) CacheService(ctx context.Context) error {
+	c := cache.NewCache(b.cfg.Redis.Addr, b.cfg.Redis.Password, b.cfg.Redis.DB)
+	if err := c.Ping(ctx); err != nil {
+		c.Close()
+		return err
+	}
 	log.Println("Cache initialized")
 	b.cache = c
+	return nil
 }
 
-func (b *BingeService) BloomFilter() error {
-	bf, err := bloomfilter.InitializeGlobalBloomFilter()
+func (b *BingeService) ResizeNotifier(ctx context.Context) error {
+	conn, err := kafka.DialLeader(ctx, "tcp", b.cfg.Kafka.Brokers[0], b.cfg.Kafka.ResizeTopic, 0)
+	if err != nil {
+		return err
+	}
+	b.notifier = bloomfilter.NewKafkaNotifier(conn)
+	return nil
+}
+
+func (b *BingeService) BloomFilter(ctx context.Context) error {
+	var notifier bloomfilter.ResizeNotifier = bloomfilter.LogNotifier{}
+	if b.notifier != nil {
+		notifier = b.notifier
+	}
+
+	bf, err := bloomfilter.NewRedisStore(b.cache, bloomfilter.Config{
+		ExpectedItems: b.cfg.BloomFilter.ExpectedItems,
+		FPRate:        b.cfg.BloomFilter.FPRate,
+		Notifier:      notifier,
+	})
 	if err != nil {
 		return err
 	}
@@ -72,26 +141,72 @@ func (b *BingeService) BloomFilter() error {
 }
 
 func (b *BingeService) APIService() *chi.Mux {
-	return api.NewAPIServer(b.db, b.cache, b.es, b.bf)
+	return api.NewAPIServer(b.db, b.cache, b.es, b.bf, b.cfg.AdminToken)
 }
 
-func (b *BingeService) ESService() error {
-	client, bi, index, err := es.NewClient(os.Getenv("CLOUD_ID_ES"), "users", os.Getenv("API_KEY_ES"))
+func (b *BingeService) ESService(ctx context.Context) error {
+	esCfg := b.cfg.Elasticsearch
+	client, bi, index, err := es.NewClient(esCfg.ClientConfig, esCfg.Index)
 	if err != nil {
 		return err
 	}
 	b.es = &es.ES{
-		Cl:    client,
-		Bi:    bi,
-		Index: index,
+		Cl:      client,
+		Bi:      bi,
+		Index:   index,
+		Ranking: b.cfg.Ranking,
 	}
 	log.Println("ES service started")
 	return nil
 }
 
 func main() {
-	bingeService := &BingeService{}
-	server := RunApp(bingeService)
-	log.Println("API server starting")
-	http.ListenAndServe(":3000", server)
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	ctx, stop := lifecycle.SignalContext(context.Background())
+	defer stop()
+
+	container := lifecycle.New()
+	router, err := RunApp(ctx, &BingeService{cfg: cfg}, container)
+	if err != nil {
+		log.Fatalf("Error starting: %v", err)
+	}
+	server := &http.Server{Addr: cfg.HTTP.Addr, Handler: router}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Println("API server starting")
+		serveErr <- server.ListenAndServe()
+	}()
+
+	// A server that failed, say because its port is taken, still has the
+	// components stopped before the process exits non-zero.
+	var failed error
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			failed = err
+			log.Printf("API server failed: %v", err)
+		}
+	case <-ctx.Done():
+		log.Println("Shutting down")
+	}
+
+	// The server stops first so that no request is still using a component
+	// when it is stopped.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error stopping API server: %v", err)
+	}
+	if err := container.Stop(shutdownCtx); err != nil {
+		log.Fatalf("Error shutting down: %v", err)
+	}
+	if failed != nil {
+		log.Fatalf("Shut down after API server failed: %v", failed)
+	}
+	log.Println("Shut down cleanly")
 }
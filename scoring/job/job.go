@@ -0,0 +1,27 @@
+package main
+
+import (
+	"binge/config"
+	"binge/db"
+	"binge/scoring"
+	"context"
+	"flag"
+	"log"
+	"os"
+)
+
+func main() {
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	database, err := db.NewDB(cfg.MySQL.User, cfg.MySQL.Password, cfg.MySQL.Addr, cfg.MySQL.Database)
+	if err != nil {
+		log.Fatalf("Error setting up DB: %v", err)
+	}
+
+	if err := scoring.Run(context.Background(), database); err != nil {
+		log.Fatalf("Error scoring users: %v", err)
+	}
+}
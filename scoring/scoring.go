@@ -0,0 +1,59 @@
+package scoring
+
+import (
+	"binge/db"
+	"binge/db/migr"
+	"context"
+	"fmt"
+	"log"
+	"math"
+)
+
+const (
+	// minSwiperWeight keeps swipes from users who right-swipe everyone from
+	// counting for nothing at all.
+	minSwiperWeight = 0.1
+	// prior and priorWeight smooth the score towards the middle, so a user
+	// with a handful of swipes does not jump straight to 0 or 1.
+	prior       = 0.5
+	priorWeight = 5
+	// minChange skips writes that would not move the score noticeably. Each
+	// write is a row update that CDC ships to Elasticsearch.
+	minChange = 0.001
+)
+
+// Desirability is the weighted share of right swipes a user received,
+// smoothed towards prior. Each incoming swipe is weighted by the swiper's
+// selectivity, so a right swipe from someone who rarely swipes right counts
+// for more than one from someone who swipes right on everybody.
+func Desirability(weightedRights float64, weightedTotal float64) float64 {
+	return (weightedRights + prior*priorWeight) / (weightedTotal + priorWeight)
+}
+
+// Run recomputes every swiped-on user's desirability and stores it in MySQL.
+// The users CDC pipeline then carries it into the users index for ranking.
+func Run(ctx context.Context, database *db.DB) error {
+	stats, err := database.ListIncomingSwipeStats(ctx, minSwiperWeight)
+	if err != nil {
+		return fmt.Errorf("error aggregating swipes: %w", err)
+	}
+
+	updated := 0
+	for _, stat := range stats {
+		score := Desirability(stat.WeightedRights, stat.WeightedTotal)
+		if math.Abs(score-stat.Desirability) < minChange {
+			continue
+		}
+		err := database.UpdateDesirability(ctx, migr.UpdateDesirabilityParams{
+			Desirability: score,
+			ID:           stat.UserSwipedOn,
+		})
+		if err != nil {
+			return fmt.Errorf("error updating desirability for user %d: %w", stat.UserSwipedOn, err)
+		}
+		updated++
+	}
+
+	log.Printf("scored %d users, updated %d", len(stats), updated)
+	return nil
+}